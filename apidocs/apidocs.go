@@ -0,0 +1,33 @@
+// Package apidocs serves the OpenAPI document of the API and a viewer for it
+// that works offline. openapi.json is written by hand; the package test fails
+// when it and the router disagree.
+package apidocs
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+//go:embed viewer.html
+var viewer []byte
+
+// Spec returns the OpenAPI document.
+func Spec() []byte {
+	return spec
+}
+
+// SpecHandler serves the OpenAPI document.
+func SpecHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(spec)
+}
+
+// ViewerHandler serves a self-contained HTML page that renders the document
+// from /openapi.json and can send requests with the browser's session.
+func ViewerHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(viewer)
+}
@@ -0,0 +1,111 @@
+package apidocs_test
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+	"watcher/apidocs"
+	"watcher/config"
+	"watcher/handlers"
+
+	"github.com/gorilla/mux"
+)
+
+// TestRoutesDocumented fails when a route of the router has no operation in
+// openapi.json, or an operation has no route.
+func TestRoutesDocumented(t *testing.T) {
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(apidocs.Spec(), &doc); err != nil {
+		t.Fatalf("invalid openapi.json: %v", err)
+	}
+
+	app, err := handlers.NewApp(config.NewServices(&config.Config{Auth: config.AuthConfig{Backend: "mysql"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := map[string]bool{}
+	err = app.Router().Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil // subrouter prefixes match no method
+		}
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			routes[method+" "+stripPatterns(template)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var undocumented []string
+	for route := range routes {
+		method, path, _ := strings.Cut(route, " ")
+		if _, ok := doc.Paths[path][strings.ToLower(method)]; !ok {
+			undocumented = append(undocumented, route)
+		}
+	}
+	sort.Strings(undocumented)
+	for _, route := range undocumented {
+		t.Errorf("route %s is missing from openapi.json", route)
+	}
+
+	var unrouted []string
+	for path, operations := range doc.Paths {
+		for method := range operations {
+			if route := strings.ToUpper(method) + " " + path; !routes[route] {
+				unrouted = append(unrouted, route)
+			}
+		}
+	}
+	sort.Strings(unrouted)
+	for _, route := range unrouted {
+		t.Errorf("operation %s in openapi.json has no route", route)
+	}
+}
+
+func TestStripPatterns(t *testing.T) {
+	for template, want := range map[string]string{
+		"/users/{userId}":                  "/users/{userId}",
+		"/auth/impersonate/{nip:[0-9]+}":   "/auth/impersonate/{nip}",
+		"/mfwp/get/{npwp:[0-9]{15}}":       "/mfwp/get/{npwp}",
+		"/a/{x:[a-z]{2,3}}/b/{y:[0-9]{4}}": "/a/{x}/b/{y}",
+	} {
+		if got := stripPatterns(template); got != want {
+			t.Errorf("stripPatterns(%q) = %q, want %q", template, got, want)
+		}
+	}
+}
+
+// stripPatterns removes the regular expressions of path variables, so
+// /mfwp/get/{npwp:[0-9]{15}} becomes /mfwp/get/{npwp} as in OpenAPI.
+func stripPatterns(template string) string {
+	var b strings.Builder
+	depth := 0
+	inPattern := false
+	for _, c := range template {
+		switch {
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				inPattern = false
+			}
+		case c == ':' && depth == 1:
+			inPattern = true
+		}
+		if !inPattern {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
@@ -1,20 +1,99 @@
 package config
 
 import (
-	"database/sql"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"time"
 
-	"github.com/go-redis/redis/v8"
-	_ "github.com/go-sql-driver/mysql"
+	"watcher/store"
 
-	// "github.com/go-redis/redis/v8"
+	"github.com/go-redis/redis/v8"
 	"gopkg.in/yaml.v2"
 )
 
 type Config struct {
-	Redis RedisConfig            `yaml:"redis"`
-	MySQL map[string]MySQLConfig `yaml:"mysql"`
+	Server      ServerConfig           `yaml:"server"`
+	Paths       PathsConfig            `yaml:"paths"`
+	Reload      ReloadConfig           `yaml:"reload"`
+	Log         LogConfig              `yaml:"log"`
+	Metrics     MetricsConfig          `yaml:"metrics"`
+	Redis       RedisConfig            `yaml:"redis"`
+	MySQL       map[string]MySQLConfig `yaml:"mysql"`
+	Migrations  MigrationsConfig       `yaml:"migrations"`
+	Session     SessionConfig          `yaml:"session"`
+	Login       LoginConfig            `yaml:"login"`
+	Auth        AuthConfig             `yaml:"auth"`
+	APITokens   APITokenConfig         `yaml:"api_tokens"`
+	TwoFactor   TwoFactorConfig        `yaml:"two_factor"`
+	Proxy       ProxyConfig            `yaml:"proxy"`
+	Permissions map[string][]string    `yaml:"permissions"` // route name -> roles allowed
+}
+
+type ServerConfig struct {
+	Addr        string `yaml:"addr"`        // listen address, e.g. "localhost:3000"
+	Ghostscript string `yaml:"ghostscript"` // Ghostscript binary: "gs" on Linux, "gswin64c" on Windows
+
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`     // whole request including uploads
+	WriteTimeout      time.Duration `yaml:"write_timeout"`    // must cover the slowest PDF compression
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`     // keep-alive connections
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"` // how long SIGINT/SIGTERM waits for requests and cron jobs
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level"`  // debug, info, warn or error
+	Format string `yaml:"format"` // "text", or "json" for log collectors
+}
+
+// PathsConfig holds the directories the handlers read and write. Relative
+// paths are resolved against Root, which defaults to the working directory.
+type PathsConfig struct {
+	Root              string `yaml:"root"`
+	Libs              string `yaml:"libs"`               // outbox.xlsx, outbox.json, scanned.json
+	Scanned           string `yaml:"scanned"`            // scanned documents named <owner>_<title>.pdf
+	PDFCompression    string `yaml:"pdf_compression"`    // holds input/ and output/
+	Documentations    string `yaml:"documentations"`     // one folder per category
+	DocumentationsRaw string `yaml:"documentations_raw"` // raw files listed by /docs/generate
+}
+
+// PDFCompressionInput is the directory Ghostscript reads from.
+func (p PathsConfig) PDFCompressionInput() string {
+	return filepath.Join(p.PDFCompression, "input")
+}
+
+// PDFCompressionOutput is the directory Ghostscript writes to.
+func (p PathsConfig) PDFCompressionOutput() string {
+	return filepath.Join(p.PDFCompression, "output")
+}
+
+// MigrationsConfig controls the schema migrations in migrations/<database>.
+type MigrationsConfig struct {
+	OnStart     string        `yaml:"on_start"`     // "up" applies pending migrations on connect, "none" leaves it to `migrate up`
+	LockTimeout time.Duration `yaml:"lock_timeout"` // how long to wait for another server's run to finish
+}
+
+type SessionConfig struct {
+	Store            string        `yaml:"store"`             // "redis" (default) or "memory"
+	IdleTimeout      time.Duration `yaml:"idle_timeout"`      // renewed on every authenticated request
+	AbsoluteLifetime time.Duration `yaml:"absolute_lifetime"` // hard cap counted from login
+	BindIP           string        `yaml:"bind_ip"`           // "none", "ip" or "subnet"
+	BindIPv4Prefix   int           `yaml:"bind_ipv4_prefix"`  // subnet size when bind_ip is "subnet"
+	BindIPv6Prefix   int           `yaml:"bind_ipv6_prefix"`
+}
+
+type MetricsConfig struct {
+	Enabled bool `yaml:"enabled"` // serve Prometheus metrics on /metrics
+	// addresses or CIDR ranges allowed to scrape /metrics, empty allows everyone
+	Allowed []string `yaml:"allowed"`
+}
+
+type ProxyConfig struct {
+	// addresses or CIDR ranges of reverse proxies whose X-Forwarded-For and
+	// Forwarded headers are trusted
+	Trusted []string `yaml:"trusted"`
 }
 
 type RedisConfig struct {
@@ -29,89 +108,321 @@ type MySQLConfig struct {
 	Host     string `yaml:"host"`
 	Port     string `yaml:"port"`
 	Database string `yaml:"database"`
+
+	// Optional databases may be down at startup: the server starts without
+	// them, their routes answer 503, and they are reconnected in the background.
+	Optional bool `yaml:"optional"`
+
+	// DSN options
+	TLS     string `yaml:"tls"`     // "", "false", "true", "skip-verify" or "preferred"
+	Loc     string `yaml:"loc"`     // time zone of DATETIME values, e.g. "Local" or "Asia/Jakarta" (default UTC)
+	Charset string `yaml:"charset"` // connection character set (default utf8mb4)
+
+	// Pool settings. MaxOpenConns is 10 when unset or 0, and -1 lifts the
+	// limit (what 0 means to database/sql).
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+
+	// ConnectRetries is how often a failed connection to a required database
+	// is retried at startup, waiting RetryBackoff and doubling it after each
+	// attempt. Optional databases are tried once and then reconnected in the
+	// background with the same backoff.
+	ConnectRetries int           `yaml:"connect_retries"`
+	RetryBackoff   time.Duration `yaml:"retry_backoff"`
 }
 
-var (
-	AppConfig   Config
-	RedisClient *redis.Client
-	DB          map[string]*sql.DB
-)
+// DefaultConfigPath is used when neither --config nor GOFS_CONFIG is given.
+const DefaultConfigPath = "config/config.yaml"
 
-func LoadConfig() error {
-	configPath := "config/config.yaml"
+// Load reads the yaml file at configPath, applies GOFS_* environment
+// overrides and defaults, and validates the result. All problems found are
+// reported together.
+func Load(configPath string) (*Config, error) {
 	configFile, err := os.ReadFile(configPath)
 	if err != nil {
-		return fmt.Errorf("failed to read config file: %w", err)
+		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	err = yaml.Unmarshal(configFile, &AppConfig)
+	var cfg Config
+	err = yaml.Unmarshal(configFile, &cfg)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal config: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
-	return nil
-}
 
-func InitRedis() error {
-	RedisClient = redis.NewClient(&redis.Options{
-		Addr:     AppConfig.Redis.Addr,
-		Password: AppConfig.Redis.Password,
-		DB:       AppConfig.Redis.DB,
-	})
+	envErrs := applyEnv(&cfg)
+	applyDefaults(&cfg)
 
-	// Ping to check connection
-	_, err := RedisClient.Ping(RedisClient.Context()).Result()
-	if err != nil {
-		return fmt.Errorf("failed to connect to Redis: %w", err)
+	if err := errors.Join(append(envErrs, cfg.Validate())...); err != nil {
+		return nil, fmt.Errorf("invalid configuration in %s:\n%w", configPath, err)
 	}
-	fmt.Println("Connected to Redis!")
-	return nil
+	return &cfg, nil
 }
 
-func InitMySQL() error {
-	DB = make(map[string]*sql.DB)
-	for name, config := range AppConfig.MySQL {
-		// Connect without specifying the database
-		dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/?parseTime=true",
-			config.User,
-			config.Password,
-			config.Host,
-			config.Port)
+type LoginConfig struct {
+	MaxAttempts   int           `yaml:"max_attempts"`    // failures per NIP before lockout
+	MaxAttemptsIP int           `yaml:"max_attempts_ip"` // failures per client IP before lockout, kept on success
+	FreeAttempts  int           `yaml:"free_attempts"`   // failures allowed before delays start
+	BaseDelay     time.Duration `yaml:"base_delay"`      // doubled on every further failure
+	Window        time.Duration `yaml:"window"`          // how long failures are remembered
+	Lockout       time.Duration `yaml:"lockout"`
+}
 
-		db, err := sql.Open("mysql", dsn)
-		if err != nil {
-			return fmt.Errorf("failed to open database connection for %s: %w", name, err)
-		}
+type AuthConfig struct {
+	Backend string     `yaml:"backend"` // "mysql" (default) or "ldap"
+	LDAP    LDAPConfig `yaml:"ldap"`
+}
 
-		if err = db.Ping(); err != nil {
-			return fmt.Errorf("failed to connect to MySQL for %s: %w", name, err)
-		}
+type LDAPConfig struct {
+	URL                string            `yaml:"url"` // ldap://host:389 or ldaps://host:636
+	StartTLS           bool              `yaml:"start_tls"`
+	InsecureSkipVerify bool              `yaml:"insecure_skip_verify"`
+	BindDN             string            `yaml:"bind_dn"` // service account used to look users up
+	BindPassword       string            `yaml:"bind_password"`
+	BaseDN             string            `yaml:"base_dn"`
+	UserFilter         string            `yaml:"user_filter"` // %s is replaced by the escaped NIP
+	Attributes         LDAPAttributes    `yaml:"attributes"`
+	DefaultRole        string            `yaml:"default_role"`
+	GroupRoles         map[string]string `yaml:"group_roles"` // memberOf DN -> role
+	Timeout            time.Duration     `yaml:"timeout"`
+}
 
-		// Create the database if it doesn't exist
-		_, err = db.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", config.Database))
-		if err != nil {
-			return fmt.Errorf("failed to create database %s: %w", config.Database, err)
-		}
-		db.Close()
+// LDAPAttributes names the directory attributes mapped into AuthData.
+type LDAPAttributes struct {
+	UserID       string `yaml:"user_id"`
+	Name         string `yaml:"name"`
+	NIP          string `yaml:"nip"`
+	Jabatan      string `yaml:"jabatan"`
+	DepartmentID string `yaml:"department_id"`
+	Role         string `yaml:"role"`
+}
 
-		// Connect to the specific database
-		dsn = fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
-			config.User,
-			config.Password,
-			config.Host,
-			config.Port,
-			config.Database)
+type APITokenConfig struct {
+	DefaultLifetime time.Duration `yaml:"default_lifetime"`
+	MaxLifetime     time.Duration `yaml:"max_lifetime"`
+}
 
-		db, err = sql.Open("mysql", dsn)
-		if err != nil {
-			return fmt.Errorf("failed to open database connection for %s: %w", name, err)
+type TwoFactorConfig struct {
+	Issuer        string        `yaml:"issuer"`         // shown in authenticator apps
+	RequiredRoles []string      `yaml:"required_roles"` // default policy, supervisors can override at runtime
+	ChallengeTTL  time.Duration `yaml:"challenge_ttl"`  // time allowed between password and code
+}
+
+// applyDefaults fills in settings left empty in config.yaml.
+func applyDefaults(cfg *Config) {
+	if cfg.Server.Addr == "" {
+		cfg.Server.Addr = "localhost:3000"
+	}
+	if cfg.Server.Ghostscript == "" {
+		cfg.Server.Ghostscript = "gsc"
+	}
+	if cfg.Server.ReadHeaderTimeout <= 0 {
+		cfg.Server.ReadHeaderTimeout = 10 * time.Second
+	}
+	if cfg.Server.ReadTimeout <= 0 {
+		cfg.Server.ReadTimeout = 2 * time.Minute
+	}
+	if cfg.Server.WriteTimeout <= 0 {
+		cfg.Server.WriteTimeout = 5 * time.Minute
+	}
+	if cfg.Server.IdleTimeout <= 0 {
+		cfg.Server.IdleTimeout = 2 * time.Minute
+	}
+	if cfg.Server.ShutdownTimeout <= 0 {
+		cfg.Server.ShutdownTimeout = time.Minute
+	}
+
+	for name, db := range cfg.MySQL {
+		if db.Charset == "" {
+			db.Charset = "utf8mb4"
+		}
+		if db.MaxOpenConns == 0 {
+			db.MaxOpenConns = 10
+		}
+		if db.MaxIdleConns == 0 {
+			db.MaxIdleConns = 5
+			if db.MaxOpenConns > 0 {
+				// a lower max_open_conns would reject the default in validate
+				db.MaxIdleConns = min(db.MaxIdleConns, db.MaxOpenConns)
+			}
+		}
+		if db.ConnMaxLifetime == 0 {
+			db.ConnMaxLifetime = 30 * time.Minute
+		}
+		if db.ConnMaxIdleTime == 0 {
+			db.ConnMaxIdleTime = 5 * time.Minute
+		}
+		if db.ConnectRetries == 0 {
+			db.ConnectRetries = 5
 		}
+		if db.RetryBackoff == 0 {
+			db.RetryBackoff = time.Second
+		}
+		cfg.MySQL[name] = db
+	}
+
+	if cfg.Migrations.OnStart == "" {
+		cfg.Migrations.OnStart = "up"
+	}
+	if cfg.Migrations.LockTimeout == 0 {
+		cfg.Migrations.LockTimeout = time.Minute
+	}
+
+	if cfg.Reload.Interval <= 0 {
+		cfg.Reload.Interval = 5 * time.Second
+	}
+	if cfg.Reload.Drain <= 0 {
+		cfg.Reload.Drain = time.Minute
+	}
+
+	if cfg.Log.Level == "" {
+		cfg.Log.Level = "info"
+	}
+	if cfg.Log.Format == "" {
+		cfg.Log.Format = "text"
+	}
 
-		if err = db.Ping(); err != nil {
-			return fmt.Errorf("failed to connect to MySQL for %s: %w", name, err)
+	paths := &cfg.Paths
+	if paths.Root == "" {
+		paths.Root = "."
+	}
+	for _, p := range []struct {
+		value *string
+		def   string
+	}{
+		{&paths.Libs, filepath.Join("src", "libs")},
+		{&paths.Scanned, filepath.Join("src", "scanned")},
+		{&paths.PDFCompression, filepath.Join("tmp", "pdfcompression")},
+		{&paths.Documentations, "documentations"},
+		{&paths.DocumentationsRaw, filepath.Join("documentations", "raw")},
+	} {
+		if *p.value == "" {
+			*p.value = p.def
+		}
+		if !filepath.IsAbs(*p.value) {
+			*p.value = filepath.Join(paths.Root, *p.value)
 		}
+	}
 
-		DB[name] = db
-		fmt.Printf("Connected to MySQL database '%s'!\n", name)
+	if cfg.Session.Store == "" {
+		cfg.Session.Store = "redis"
+	}
+	if cfg.Session.IdleTimeout <= 0 {
+		cfg.Session.IdleTimeout = 30 * time.Minute
+	}
+	if cfg.Session.AbsoluteLifetime <= 0 {
+		cfg.Session.AbsoluteLifetime = 12 * time.Hour
+	}
+	if cfg.Session.IdleTimeout > cfg.Session.AbsoluteLifetime {
+		cfg.Session.IdleTimeout = cfg.Session.AbsoluteLifetime
+	}
+	if cfg.Session.BindIP == "" {
+		cfg.Session.BindIP = "none"
+	}
+	if cfg.Session.BindIPv4Prefix <= 0 {
+		cfg.Session.BindIPv4Prefix = 24
+	}
+	if cfg.Session.BindIPv6Prefix <= 0 {
+		cfg.Session.BindIPv6Prefix = 64
+	}
+
+	if cfg.Login.MaxAttempts <= 0 {
+		cfg.Login.MaxAttempts = 10
+	}
+	if cfg.Login.MaxAttemptsIP <= 0 {
+		cfg.Login.MaxAttemptsIP = 50
+	}
+	if cfg.Login.FreeAttempts <= 0 {
+		cfg.Login.FreeAttempts = 3
+	}
+	if cfg.Login.BaseDelay <= 0 {
+		cfg.Login.BaseDelay = time.Second
+	}
+	if cfg.Login.Window <= 0 {
+		cfg.Login.Window = 15 * time.Minute
+	}
+	if cfg.Login.Lockout <= 0 {
+		cfg.Login.Lockout = 15 * time.Minute
+	}
+
+	if cfg.Auth.Backend == "" {
+		cfg.Auth.Backend = "mysql"
+	}
+	ldap := &cfg.Auth.LDAP
+	if ldap.UserFilter == "" {
+		ldap.UserFilter = "(employeeID=%s)"
+	}
+	if ldap.Attributes.UserID == "" {
+		ldap.Attributes.UserID = "sAMAccountName"
+	}
+	if ldap.Attributes.Name == "" {
+		ldap.Attributes.Name = "displayName"
+	}
+	if ldap.Attributes.NIP == "" {
+		ldap.Attributes.NIP = "employeeID"
+	}
+	if ldap.Attributes.Jabatan == "" {
+		ldap.Attributes.Jabatan = "title"
+	}
+	if ldap.Attributes.DepartmentID == "" {
+		ldap.Attributes.DepartmentID = "departmentNumber"
+	}
+	if ldap.DefaultRole == "" {
+		ldap.DefaultRole = "contributor"
+	}
+	if ldap.Timeout <= 0 {
+		ldap.Timeout = 10 * time.Second
+	}
+
+	if cfg.APITokens.DefaultLifetime <= 0 {
+		cfg.APITokens.DefaultLifetime = 30 * 24 * time.Hour
+	}
+	if cfg.APITokens.MaxLifetime <= 0 {
+		cfg.APITokens.MaxLifetime = 365 * 24 * time.Hour
+	}
+
+	if cfg.TwoFactor.Issuer == "" {
+		cfg.TwoFactor.Issuer = "gofs"
+	}
+	if cfg.TwoFactor.ChallengeTTL <= 0 {
+		cfg.TwoFactor.ChallengeTTL = 5 * time.Minute
+	}
+}
+
+// newRedisClient returns a client for cfg and an error if it cannot ping. The
+// client is usable either way and keeps reconnecting on its own.
+func newRedisClient(cfg RedisConfig) (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	// Ping to check connection
+	_, err := client.Ping(client.Context()).Result()
+	if err != nil {
+		return client, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	slog.Info("connected to Redis", "addr", cfg.Addr)
+	return client, nil
+}
+
+// newSessionStore builds the store selected by session.store. An unreachable
+// Redis is not fatal: the client keeps reconnecting in the background and
+// requests needing a session fail until it is back.
+func newSessionStore(cfg *Config) (store.SessionStore, error) {
+	switch cfg.Session.Store {
+	case "memory":
+		slog.Warn("using in-memory session store, sessions are lost on restart")
+		return store.NewMemoryStore(time.Minute), nil
+	case "redis":
+		client, err := newRedisClient(cfg.Redis)
+		if err != nil {
+			slog.Warn("Redis unavailable, will keep retrying", "error", err)
+		}
+		return store.NewRedisStore(client, 30*time.Second), nil
+	default:
+		return nil, fmt.Errorf("unknown session store %q", cfg.Session.Store)
 	}
-	return nil
 }
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix prefixes every environment variable that overrides config.yaml.
+// The rest of the name is the yaml path in upper case joined by underscores,
+// e.g. GOFS_REDIS_ADDR or GOFS_MYSQL_DOCTRACER_PASSWORD. Appending _FILE reads
+// the value from a file instead, for container secrets.
+const EnvPrefix = "GOFS"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+var envNameCleaner = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// envName turns a yaml key into its environment variable segment.
+func envName(key string) string {
+	return strings.Trim(envNameCleaner.ReplaceAllString(strings.ToUpper(key), "_"), "_")
+}
+
+// lookupEnv reads NAME, or the file named by NAME_FILE with surrounding
+// whitespace such as the trailing newline of most secret files removed.
+func lookupEnv(name string) (string, bool, error) {
+	if path, ok := os.LookupEnv(name + "_FILE"); ok {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		return strings.TrimSpace(string(content)), true, nil
+	}
+	value, ok := os.LookupEnv(name)
+	return value, ok, nil
+}
+
+// applyEnv overrides cfg with environment variables and returns every value
+// that could not be parsed.
+func applyEnv(cfg *Config) []error {
+	return applyEnvValue(reflect.ValueOf(cfg).Elem(), EnvPrefix)
+}
+
+func applyEnvValue(v reflect.Value, name string) []error {
+	var errs []error
+
+	switch {
+	case v.Kind() == reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			key := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+			if key == "" || key == "-" {
+				continue
+			}
+			errs = append(errs, applyEnvValue(v.Field(i), name+"_"+envName(key))...)
+		}
+		return errs
+
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for _, key := range mapKeysFromEnv(v, name) {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if existing := v.MapIndex(reflect.ValueOf(key)); existing.IsValid() {
+				elem.Set(existing)
+			}
+			errs = append(errs, applyEnvValue(elem, name+"_"+envName(key))...)
+			if !elem.IsZero() {
+				v.SetMapIndex(reflect.ValueOf(key), elem)
+			}
+		}
+		return errs
+	}
+
+	value, ok, err := lookupEnv(name)
+	if err != nil {
+		return []error{err}
+	}
+	if !ok {
+		return nil
+	}
+	if err := setFromString(v, value); err != nil {
+		return []error{fmt.Errorf("%s: %w", name, err)}
+	}
+	return nil
+}
+
+// mapKeysFromEnv returns the keys of a map plus, for maps of structs, keys only
+// named in the environment, so a whole MySQL database can be added with
+// GOFS_MYSQL_<NAME>_HOST and friends.
+func mapKeysFromEnv(v reflect.Value, name string) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, key := range v.MapKeys() {
+		seen[envName(key.String())] = true
+		keys = append(keys, key.String())
+	}
+
+	elemType := v.Type().Elem()
+	if elemType.Kind() != reflect.Struct {
+		return keys
+	}
+
+	var fields []string
+	for i := 0; i < elemType.NumField(); i++ {
+		if key := strings.Split(elemType.Field(i).Tag.Get("yaml"), ",")[0]; key != "" && key != "-" {
+			fields = append(fields, envName(key))
+		}
+	}
+
+	prefix := name + "_"
+	for _, entry := range os.Environ() {
+		envKey, _, _ := strings.Cut(entry, "=")
+		envKey = strings.TrimSuffix(envKey, "_FILE")
+		if !strings.HasPrefix(envKey, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(envKey, prefix)
+		for _, field := range fields {
+			if mapKey, ok := strings.CutSuffix(rest, "_"+field); ok && mapKey != "" && !seen[mapKey] {
+				seen[mapKey] = true
+				keys = append(keys, strings.ToLower(mapKey))
+			}
+		}
+	}
+	return keys
+}
+
+func setFromString(v reflect.Value, value string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		v.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported list type %s", v.Type())
+		}
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
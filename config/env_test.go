@@ -0,0 +1,161 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyEnvNestedStructs(t *testing.T) {
+	t.Setenv("GOFS_SERVER_ADDR", "0.0.0.0:8080")
+	t.Setenv("GOFS_SESSION_STORE", "memory")
+	t.Setenv("GOFS_SESSION_IDLE_TIMEOUT", "45m")
+	t.Setenv("GOFS_LOGIN_MAX_ATTEMPTS", "7")
+	t.Setenv("GOFS_METRICS_ENABLED", "true")
+	t.Setenv("GOFS_PROXY_TRUSTED", " 10.0.0.1, 192.168.0.0/16 ,")
+	t.Setenv("GOFS_AUTH_LDAP_ATTRIBUTES_NIP", "employeeNumber")
+
+	cfg := Config{Server: ServerConfig{Addr: "localhost:3000", Ghostscript: "gs"}}
+	if errs := applyEnv(&cfg); len(errs) > 0 {
+		t.Fatalf("applyEnv: %v", errs)
+	}
+
+	if cfg.Server.Addr != "0.0.0.0:8080" {
+		t.Errorf("Server.Addr = %q", cfg.Server.Addr)
+	}
+	if cfg.Server.Ghostscript != "gs" {
+		t.Errorf("Server.Ghostscript = %q, want the yaml value kept", cfg.Server.Ghostscript)
+	}
+	if cfg.Session.Store != "memory" {
+		t.Errorf("Session.Store = %q", cfg.Session.Store)
+	}
+	if cfg.Session.IdleTimeout != 45*time.Minute {
+		t.Errorf("Session.IdleTimeout = %v", cfg.Session.IdleTimeout)
+	}
+	if cfg.Login.MaxAttempts != 7 {
+		t.Errorf("Login.MaxAttempts = %d", cfg.Login.MaxAttempts)
+	}
+	if !cfg.Metrics.Enabled {
+		t.Error("Metrics.Enabled = false")
+	}
+	if want := []string{"10.0.0.1", "192.168.0.0/16"}; !reflect.DeepEqual(cfg.Proxy.Trusted, want) {
+		t.Errorf("Proxy.Trusted = %q, want %q", cfg.Proxy.Trusted, want)
+	}
+	if cfg.Auth.LDAP.Attributes.NIP != "employeeNumber" {
+		t.Errorf("Auth.LDAP.Attributes.NIP = %q", cfg.Auth.LDAP.Attributes.NIP)
+	}
+}
+
+func TestApplyEnvMapKeys(t *testing.T) {
+	t.Setenv("GOFS_MYSQL_DOCTRACER_PASSWORD", "secret")
+	t.Setenv("GOFS_MYSQL_DOCTRACER_RETRY_BACKOFF", "250ms")
+	t.Setenv("GOFS_MYSQL_REPORTS_HOST", "db.internal")
+	t.Setenv("GOFS_MYSQL_REPORTS_OPTIONAL", "1")
+	t.Setenv("GOFS_MYSQL_AUDIT_LOG_DATABASE", "audit")
+
+	cfg := Config{MySQL: map[string]MySQLConfig{
+		"doctracer": {User: "root", Host: "127.0.0.1", Database: "doctracer"},
+	}}
+	if errs := applyEnv(&cfg); len(errs) > 0 {
+		t.Fatalf("applyEnv: %v", errs)
+	}
+
+	doctracer := cfg.MySQL["doctracer"]
+	if doctracer.Password != "secret" || doctracer.RetryBackoff != 250*time.Millisecond {
+		t.Errorf("doctracer = %+v, want password and retry_backoff overridden", doctracer)
+	}
+	if doctracer.User != "root" || doctracer.Host != "127.0.0.1" || doctracer.Database != "doctracer" {
+		t.Errorf("doctracer = %+v, want the yaml values kept", doctracer)
+	}
+
+	reports, ok := cfg.MySQL["reports"]
+	if !ok {
+		t.Fatalf("MySQL keys = %v, want reports added from the environment", reflect.ValueOf(cfg.MySQL).MapKeys())
+	}
+	if reports.Host != "db.internal" || !reports.Optional {
+		t.Errorf("reports = %+v", reports)
+	}
+	if got := cfg.MySQL["audit_log"].Database; got != "audit" {
+		t.Errorf("audit_log database = %q, want a key with an underscore discovered", got)
+	}
+	if len(cfg.MySQL) != 3 {
+		t.Errorf("MySQL has %d databases, want 3", len(cfg.MySQL))
+	}
+}
+
+func TestApplyEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Setenv("GOFS_REDIS_PASSWORD_FILE", write("redis", "  s3cret\r\n"))
+	t.Setenv("GOFS_REDIS_PASSWORD", "ignored")
+	t.Setenv("GOFS_MYSQL_DOCTRACER_PASSWORD_FILE", write("doctracer", "hunter2\n\n"))
+	t.Setenv("GOFS_REDIS_DB_FILE", write("db", "3\n"))
+
+	var cfg Config
+	if errs := applyEnv(&cfg); len(errs) > 0 {
+		t.Fatalf("applyEnv: %v", errs)
+	}
+	if cfg.Redis.Password != "s3cret" {
+		t.Errorf("Redis.Password = %q, want the trimmed file content over GOFS_REDIS_PASSWORD", cfg.Redis.Password)
+	}
+	if got := cfg.MySQL["doctracer"].Password; got != "hunter2" {
+		t.Errorf("doctracer password = %q, want a map key discovered from a _FILE variable", got)
+	}
+	if cfg.Redis.DB != 3 {
+		t.Errorf("Redis.DB = %d", cfg.Redis.DB)
+	}
+
+	t.Setenv("GOFS_REDIS_ADDR_FILE", filepath.Join(dir, "missing"))
+	errs := applyEnv(&cfg)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "GOFS_REDIS_ADDR_FILE") {
+		t.Errorf("applyEnv with a missing file = %v, want one error naming GOFS_REDIS_ADDR_FILE", errs)
+	}
+}
+
+func TestLoadReportsEveryBadEnvValue(t *testing.T) {
+	t.Setenv("GOFS_SERVER_READ_TIMEOUT", "soon")
+	t.Setenv("GOFS_LOGIN_MAX_ATTEMPTS", "many")
+	t.Setenv("GOFS_METRICS_ENABLED", "maybe")
+	t.Setenv("GOFS_MYSQL_DOCTRACER_MAX_OPEN_CONNS", "ten")
+
+	_, err := Load("config.yaml")
+	if err == nil {
+		t.Fatal("Load succeeded with invalid environment values")
+	}
+	for _, want := range []string{
+		`GOFS_SERVER_READ_TIMEOUT: invalid duration "soon"`,
+		`GOFS_LOGIN_MAX_ATTEMPTS: invalid integer "many"`,
+		`GOFS_METRICS_ENABLED: invalid boolean "maybe"`,
+		`GOFS_MYSQL_DOCTRACER_MAX_OPEN_CONNS: invalid integer "ten"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Load error does not contain %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadAppliesEnv(t *testing.T) {
+	t.Setenv("GOFS_SESSION_STORE", "memory")
+	t.Setenv("GOFS_MYSQL_MFWP_HOST", "mfwp.internal")
+
+	cfg, err := Load("config.yaml")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Session.Store != "memory" {
+		t.Errorf("Session.Store = %q", cfg.Session.Store)
+	}
+	if mfwp := cfg.MySQL["mfwp"]; mfwp.Host != "mfwp.internal" || mfwp.Database != "mfwp" {
+		t.Errorf("mfwp = %+v, want the host overridden and the yaml database kept", mfwp)
+	}
+}
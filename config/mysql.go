@@ -0,0 +1,212 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"watcher/migrations"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// maxRetryBackoff caps the doubling delay between connection attempts.
+const maxRetryBackoff = 30 * time.Second
+
+// InitMySQL connects to every configured database in parallel, creating it
+// if needed. A required database that stays unreachable after its retries
+// fails startup; an optional one gets a single attempt and is then
+// reconnected in the background, so it does not hold up startup.
+func (s *Services) InitMySQL() error {
+	cfg := s.Config()
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for name, dbCfg := range cfg.MySQL {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.startDatabase(name, dbCfg, cfg.Migrations); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// startDatabase connects and migrates one database and publishes it. An
+// optional database that cannot be used is logged and left to reconnectMySQL
+// instead of failing.
+func (s *Services) startDatabase(name string, cfg MySQLConfig, m MigrationsConfig) error {
+	retries := cfg.ConnectRetries
+	if cfg.Optional {
+		retries = 0
+	}
+	db, err := connectMySQL(name, cfg, retries)
+	if err != nil {
+		if cfg.Optional {
+			slog.Warn("optional MySQL database unavailable, its routes are disabled until it connects", "database", name, "error", err)
+			go s.reconnectMySQL(name, cfg)
+			return nil
+		}
+		return fmt.Errorf("failed to connect to MySQL for %s: %w", name, err)
+	}
+
+	if err := migrateOnStart(name, db, m); err != nil {
+		// connected, but the schema could not be brought up to date
+		db.Close()
+		if cfg.Optional {
+			slog.Warn("optional MySQL database could not be migrated, its routes are disabled until it is", "database", name, "error", err)
+			go s.reconnectMySQL(name, cfg)
+			return nil
+		}
+		return err
+	}
+
+	s.SetDatabase(name, db)
+	slog.Info("connected to MySQL", "database", name)
+	return nil
+}
+
+// connectMySQL opens the database, retrying up to retries times with
+// exponential backoff.
+func connectMySQL(name string, cfg MySQLConfig, retries int) (*sql.DB, error) {
+	backoff := cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		db, err := openMySQL(cfg)
+		if err == nil {
+			return db, nil
+		}
+		if attempt >= retries {
+			return nil, err
+		}
+		slog.Warn("MySQL not reachable, retrying", "database", name, "error", err, "retry_in", backoff)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
+
+// reconnectMySQL keeps trying to connect and migrate an optional database
+// until it succeeds, or until a reload changes or removes its configuration.
+// A failed migration is retried too, e.g. while another instance holds the
+// migration lock.
+func (s *Services) reconnectMySQL(name string, cfg MySQLConfig) {
+	backoff := cfg.RetryBackoff
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+
+		if s.Config().MySQL[name] != cfg {
+			return
+		}
+		db, err := openMySQL(cfg)
+		if err != nil {
+			continue
+		}
+		if err := migrateOnStart(name, db, s.Config().Migrations); err != nil {
+			slog.Warn("failed to migrate optional MySQL database, retrying", "database", name, "error", err, "retry_in", backoff)
+			db.Close()
+			continue
+		}
+
+		s.dbMu.Lock()
+		if s.Config().MySQL[name] != cfg || s.isClosed() {
+			s.dbMu.Unlock()
+			db.Close()
+			return
+		}
+		s.databases[name] = db
+		s.dbMu.Unlock()
+		slog.Info("connected to optional MySQL database", "database", name)
+		return
+	}
+}
+
+// migrateOnStart applies pending migrations unless migrations.on_start is "none".
+func migrateOnStart(name string, db *sql.DB, m MigrationsConfig) error {
+	if m.OnStart != "up" {
+		return nil
+	}
+	if _, err := migrations.Up(context.Background(), db, name, m.LockTimeout); err != nil {
+		return fmt.Errorf("failed to migrate %s: %w", name, err)
+	}
+	return nil
+}
+
+// openMySQL creates the database if it does not exist and returns a pool
+// connected to it with the configured limits applied.
+func openMySQL(cfg MySQLConfig) (*sql.DB, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Connect without specifying the database
+	server, err := mysqlConnector(cfg, "")
+	if err != nil {
+		return nil, err
+	}
+	db := sql.OpenDB(server)
+	_, err = db.ExecContext(ctx, "CREATE DATABASE IF NOT EXISTS "+QuoteIdentifier(cfg.Database))
+	db.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database %s: %w", cfg.Database, err)
+	}
+
+	// Connect to the specific database
+	connector, err := mysqlConnector(cfg, cfg.Database)
+	if err != nil {
+		return nil, err
+	}
+	db = sql.OpenDB(connector)
+	db.SetMaxOpenConns(max(cfg.MaxOpenConns, 0)) // -1 in config.yaml is 0, no limit, here
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// mysqlConnector builds the driver configuration, so passwords and options
+// never pass through hand-formatted DSN strings.
+func mysqlConnector(cfg MySQLConfig, database string) (driver.Connector, error) {
+	dsn := mysql.NewConfig()
+	dsn.User = cfg.User
+	dsn.Passwd = cfg.Password
+	dsn.Net = "tcp"
+	dsn.Addr = net.JoinHostPort(cfg.Host, cfg.Port)
+	dsn.DBName = database
+	dsn.ParseTime = true
+	dsn.TLSConfig = cfg.TLS
+	dsn.Params = map[string]string{"charset": cfg.Charset}
+	if cfg.Loc != "" {
+		loc, err := time.LoadLocation(cfg.Loc)
+		if err != nil {
+			return nil, err
+		}
+		dsn.Loc = loc
+	}
+	return mysql.NewConnector(dsn)
+}
+
+// QuoteIdentifier quotes a MySQL schema, table or column name.
+func QuoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
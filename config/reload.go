@@ -0,0 +1,242 @@
+package config
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"watcher/store"
+)
+
+// ReloadConfig controls reloading config.yaml while the server runs. A reload
+// is triggered by SIGHUP and, with Watch, by changes to the file.
+type ReloadConfig struct {
+	Watch    bool          `yaml:"watch"`    // poll the file for changes (SIGHUP is not available on Windows)
+	Interval time.Duration `yaml:"interval"` // how often the file is polled
+	Drain    time.Duration `yaml:"drain"`    // how long replaced Redis/MySQL clients stay open for requests in flight
+}
+
+// restartOnly lists settings read once at startup; changes are reported but
+// only take effect after a restart.
+var restartOnly = []string{"server.addr", "server.read_header_timeout", "server.read_timeout", "server.write_timeout", "server.idle_timeout", "reload.watch", "reload.interval", "log.format"}
+
+// PrepareFunc lets the caller of Reload build state of its own from the new
+// configuration, such as the authenticator. It runs after the new clients are
+// prepared and before anything is swapped; an error aborts the reload. The
+// returned apply, if not nil, is called right after the new configuration
+// is made current, still holding the reload lock.
+type PrepareFunc func(old, cfg *Config) (apply func(), err error)
+
+// Reload reads and validates the config file and makes it current. Redis and
+// MySQL clients whose settings changed are replaced: new requests use the new
+// clients and the old ones are closed after reload.drain. Nothing is changed
+// if the file is invalid, a new required database cannot be reached or
+// prepare fails. The changed settings are returned, secrets redacted.
+func (s *Services) Reload(configPath string, prepare PrepareFunc) ([]string, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+	old := s.Config()
+	changes := diffConfig(old, cfg)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	// prepare every new client first, so a failure leaves the old ones in place
+	var sessions store.SessionStore
+	if old.Session.Store != cfg.Session.Store || (cfg.Session.Store == "redis" && old.Redis != cfg.Redis) {
+		if cfg.Session.Store == "redis" {
+			client, err := newRedisClient(cfg.Redis)
+			if err != nil {
+				client.Close()
+				return nil, err
+			}
+			sessions = store.NewRedisStore(client, 30*time.Second)
+		} else if sessions, err = newSessionStore(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	pools := map[string]*sql.DB{}
+	var pending []string // optional databases to keep retrying after the swap
+	var errs []error
+	for name, dbCfg := range cfg.MySQL {
+		if oldCfg, ok := old.MySQL[name]; ok && oldCfg == dbCfg {
+			continue
+		}
+		db, err := connectMySQL(name, dbCfg, 0)
+		if err == nil {
+			if err = migrateOnStart(name, db, cfg.Migrations); err != nil {
+				db.Close()
+			}
+		}
+		switch {
+		case err == nil:
+			pools[name] = db
+		case dbCfg.Optional:
+			slog.Warn("optional MySQL database unavailable after reload", "database", name, "error", err)
+			pending = append(pending, name)
+		default:
+			errs = append(errs, fmt.Errorf("mysql.%s: %w", name, err))
+		}
+	}
+	var apply func()
+	if len(errs) == 0 && prepare != nil {
+		if apply, err = prepare(old, cfg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		for _, db := range pools {
+			db.Close()
+		}
+		if sessions != nil {
+			sessions.Close()
+		}
+		return nil, fmt.Errorf("configuration not reloaded:\n%w", errors.Join(errs...))
+	}
+
+	// swap: from here on new requests see the new configuration and clients
+	s.SetConfig(cfg)
+	if apply != nil {
+		apply()
+	}
+
+	var retired []interface{ Close() error }
+	if sessions != nil {
+		retired = append(retired, s.SetSessionStore(sessions))
+	}
+	for name, db := range pools {
+		if old := s.SetDatabase(name, db); old != nil {
+			retired = append(retired, old)
+		}
+	}
+	for _, name := range pending {
+		if old := s.SetDatabase(name, nil); old != nil {
+			retired = append(retired, old)
+		}
+		go s.reconnectMySQL(name, cfg.MySQL[name])
+	}
+	for name := range old.MySQL {
+		if _, ok := cfg.MySQL[name]; !ok {
+			if old := s.SetDatabase(name, nil); old != nil {
+				retired = append(retired, old)
+			}
+		}
+	}
+
+	if len(retired) > 0 {
+		go func() {
+			time.Sleep(cfg.Reload.Drain)
+			for _, c := range retired {
+				c.Close()
+			}
+		}()
+	}
+
+	for i, change := range changes {
+		for _, path := range restartOnly {
+			if strings.HasPrefix(change, path+":") {
+				changes[i] += " (takes effect after a restart)"
+			}
+		}
+	}
+	return changes, nil
+}
+
+// WatchConfig polls the config file every interval and calls onChange when
+// its modification time or size changes. It returns when stop is closed.
+func WatchConfig(configPath string, interval time.Duration, stop <-chan struct{}, onChange func()) {
+	stat := func() (time.Time, int64) {
+		info, err := os.Stat(configPath)
+		if err != nil {
+			return time.Time{}, -1
+		}
+		return info.ModTime(), info.Size()
+	}
+
+	lastMod, lastSize := stat()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			mod, size := stat()
+			if size < 0 || (mod.Equal(lastMod) && size == lastSize) {
+				continue
+			}
+			lastMod, lastSize = mod, size
+			onChange()
+		}
+	}
+}
+
+// diffConfig lists the settings that differ between two configurations as
+// "yaml.path: old -> new". Passwords and secrets are only reported as changed.
+func diffConfig(old, cfg *Config) []string {
+	var changes []string
+	diffValue(reflect.ValueOf(*old), reflect.ValueOf(*cfg), "", false, &changes)
+	sort.Strings(changes)
+	return changes
+}
+
+func diffValue(a, b reflect.Value, path string, secret bool, changes *[]string) {
+	switch a.Kind() {
+	case reflect.Struct:
+		t := a.Type()
+		for i := 0; i < t.NumField(); i++ {
+			key := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+			if key == "" || key == "-" {
+				continue
+			}
+			lower := strings.ToLower(key)
+			isSecret := strings.Contains(lower, "password") || strings.Contains(lower, "secret")
+			diffValue(a.Field(i), b.Field(i), joinPath(path, key), isSecret, changes)
+		}
+		return
+
+	case reflect.Map:
+		for _, key := range a.MapKeys() {
+			keyPath := joinPath(path, fmt.Sprint(key.Interface()))
+			if bv := b.MapIndex(key); bv.IsValid() {
+				diffValue(a.MapIndex(key), bv, keyPath, secret, changes)
+			} else {
+				*changes = append(*changes, keyPath+": removed")
+			}
+		}
+		for _, key := range b.MapKeys() {
+			if !a.MapIndex(key).IsValid() {
+				*changes = append(*changes, joinPath(path, fmt.Sprint(key.Interface()))+": added")
+			}
+		}
+		return
+	}
+
+	if reflect.DeepEqual(a.Interface(), b.Interface()) {
+		return
+	}
+	if secret {
+		*changes = append(*changes, path+": changed")
+		return
+	}
+	*changes = append(*changes, fmt.Sprintf("%s: %v -> %v", path, a.Interface(), b.Interface()))
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
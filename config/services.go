@@ -0,0 +1,132 @@
+package config
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"watcher/store"
+)
+
+// Services holds the live configuration and the Redis and MySQL clients built
+// from it. The server creates one from config.yaml; tests create their own
+// with NewServices, a MemoryStore and SetDatabase.
+type Services struct {
+	current atomic.Pointer[Config]
+
+	// Sessions forwards to the session store of the current configuration.
+	Sessions *store.SwapStore
+
+	dbMu      sync.RWMutex
+	databases map[string]*sql.DB
+
+	reloadMu sync.Mutex
+
+	closed    chan struct{} // closed by Close, stops background reconnects
+	closeOnce sync.Once
+}
+
+// NewServices returns Services for cfg without connecting anything. Call
+// InitSessionStore and InitMySQL, or set the stores directly in tests.
+func NewServices(cfg *Config) *Services {
+	s := &Services{
+		Sessions:  store.NewSwapStore(nil),
+		databases: map[string]*sql.DB{},
+		closed:    make(chan struct{}),
+	}
+	s.current.Store(cfg)
+	return s
+}
+
+// Config returns the active configuration. It is replaced as a whole on
+// reload, so read it once per request rather than holding on to it.
+func (s *Services) Config() *Config {
+	return s.current.Load()
+}
+
+// SetConfig replaces the active configuration without touching connections.
+func (s *Services) SetConfig(cfg *Config) {
+	s.current.Store(cfg)
+}
+
+// InitSessionStore connects the store selected by session.store.
+func (s *Services) InitSessionStore() error {
+	sessions, err := newSessionStore(s.Config())
+	if err != nil {
+		return err
+	}
+	s.SetSessionStore(sessions)
+	return nil
+}
+
+// SetSessionStore makes new requests use sessions and returns the previous store.
+func (s *Services) SetSessionStore(sessions store.SessionStore) store.SessionStore {
+	return s.Sessions.Swap(sessions)
+}
+
+// Database returns the connection pool for the named mysql entry, or nil
+// while an optional database is not connected.
+func (s *Services) Database(name string) *sql.DB {
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+	return s.databases[name]
+}
+
+// Databases returns the connected pools by mysql entry name.
+func (s *Services) Databases() map[string]*sql.DB {
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+	databases := make(map[string]*sql.DB, len(s.databases))
+	for name, db := range s.databases {
+		databases[name] = db
+	}
+	return databases
+}
+
+// SetDatabase publishes db under name, or removes the entry if db is nil,
+// and returns the pool it replaced.
+func (s *Services) SetDatabase(name string, db *sql.DB) *sql.DB {
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+	old := s.databases[name]
+	if db == nil {
+		delete(s.databases, name)
+	} else {
+		s.databases[name] = db
+	}
+	return old
+}
+
+func (s *Services) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops background reconnects and closes the session store and every
+// database pool. Database returns nil afterwards.
+func (s *Services) Close() error {
+	s.closeOnce.Do(func() { close(s.closed) })
+
+	var errs []error
+	if sessions := s.Sessions.Current(); sessions != nil {
+		if err := sessions.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("session store: %w", err))
+		}
+	}
+
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+	for name, db := range s.databases {
+		if err := db.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("mysql %s: %w", name, err))
+		}
+		delete(s.databases, name)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// identifierPattern limits database names to what can be used unquoted.
+var identifierPattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// Validate checks the loaded configuration and reports every missing or
+// malformed setting at once.
+func (cfg *Config) Validate() error {
+	var errs []error
+	missing := func(field string) {
+		errs = append(errs, fmt.Errorf("%s is required", field))
+	}
+
+	if _, _, err := net.SplitHostPort(cfg.Server.Addr); err != nil {
+		errs = append(errs, fmt.Errorf("server.addr must be host:port, got %q", cfg.Server.Addr))
+	}
+
+	switch strings.ToLower(cfg.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log.level must be debug, info, warn or error, got %q", cfg.Log.Level))
+	}
+	switch cfg.Log.Format {
+	case "text", "json":
+	default:
+		errs = append(errs, fmt.Errorf("log.format must be \"text\" or \"json\", got %q", cfg.Log.Format))
+	}
+
+	switch cfg.Session.Store {
+	case "redis":
+		if cfg.Redis.Addr == "" {
+			missing("redis.addr")
+		}
+	case "memory":
+	default:
+		errs = append(errs, fmt.Errorf("session.store must be \"redis\" or \"memory\", got %q", cfg.Session.Store))
+	}
+
+	switch cfg.Session.BindIP {
+	case "none", "ip", "subnet":
+	default:
+		errs = append(errs, fmt.Errorf("session.bind_ip must be \"none\", \"ip\" or \"subnet\", got %q", cfg.Session.BindIP))
+	}
+	if cfg.Session.BindIPv4Prefix > 32 {
+		errs = append(errs, fmt.Errorf("session.bind_ipv4_prefix must be at most 32"))
+	}
+	if cfg.Session.BindIPv6Prefix > 128 {
+		errs = append(errs, fmt.Errorf("session.bind_ipv6_prefix must be at most 128"))
+	}
+
+	if len(cfg.MySQL) == 0 {
+		missing("mysql")
+	}
+	names := make([]string, 0, len(cfg.MySQL))
+	for name := range cfg.MySQL {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		db := cfg.MySQL[name]
+		prefix := "mysql." + name
+		if db.User == "" {
+			missing(prefix + ".user")
+		}
+		if db.Host == "" {
+			missing(prefix + ".host")
+		}
+		if db.Database == "" {
+			missing(prefix + ".database")
+		} else if !identifierPattern.MatchString(db.Database) {
+			errs = append(errs, fmt.Errorf("%s.database %q may only contain letters, digits and underscores", prefix, db.Database))
+		}
+		if port, err := strconv.Atoi(db.Port); err != nil || port <= 0 || port > 65535 {
+			errs = append(errs, fmt.Errorf("%s.port %q is not a valid port", prefix, db.Port))
+		}
+		switch db.TLS {
+		case "", "false", "true", "skip-verify", "preferred":
+		default:
+			errs = append(errs, fmt.Errorf("%s.tls must be \"false\", \"true\", \"skip-verify\" or \"preferred\", got %q", prefix, db.TLS))
+		}
+		if db.Loc != "" {
+			if _, err := time.LoadLocation(db.Loc); err != nil {
+				errs = append(errs, fmt.Errorf("%s.loc: %w", prefix, err))
+			}
+		}
+		if db.MaxOpenConns < -1 {
+			errs = append(errs, fmt.Errorf("%s.max_open_conns must be -1 (no limit) or positive, got %d", prefix, db.MaxOpenConns))
+		}
+		if db.MaxIdleConns < 0 || db.ConnectRetries < 0 {
+			errs = append(errs, fmt.Errorf("%s: max_idle_conns and connect_retries may not be negative", prefix))
+		}
+		if db.MaxOpenConns > 0 && db.MaxIdleConns > db.MaxOpenConns {
+			errs = append(errs, fmt.Errorf("%s.max_idle_conns (%d) exceeds max_open_conns (%d)", prefix, db.MaxIdleConns, db.MaxOpenConns))
+		}
+	}
+	switch cfg.Migrations.OnStart {
+	case "up", "none":
+	default:
+		errs = append(errs, fmt.Errorf("migrations.on_start must be \"up\" or \"none\", got %q", cfg.Migrations.OnStart))
+	}
+
+	// users, 2FA and the impersonation audit live in doctracer whatever the
+	// auth backend, so handlers can rely on Database("doctracer") being set
+	if db, ok := cfg.MySQL["doctracer"]; !ok {
+		missing("mysql.doctracer")
+	} else if db.Optional {
+		errs = append(errs, fmt.Errorf("mysql.doctracer cannot be optional"))
+	}
+
+	switch cfg.Auth.Backend {
+	case "mysql":
+	case "ldap":
+		if cfg.Auth.LDAP.URL == "" {
+			missing("auth.ldap.url")
+		}
+		if cfg.Auth.LDAP.BaseDN == "" {
+			missing("auth.ldap.base_dn")
+		}
+		if n := strings.Count(cfg.Auth.LDAP.UserFilter, "%s"); n != 1 {
+			errs = append(errs, fmt.Errorf("auth.ldap.user_filter must contain %%s exactly once for the NIP, got %q", cfg.Auth.LDAP.UserFilter))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("auth.backend must be \"mysql\" or \"ldap\", got %q", cfg.Auth.Backend))
+	}
+
+	for _, list := range []struct {
+		path    string
+		entries []string
+	}{
+		{"proxy.trusted", cfg.Proxy.Trusted},
+		{"metrics.allowed", cfg.Metrics.Allowed},
+	} {
+		for _, entry := range list.entries {
+			if _, err := netip.ParsePrefix(entry); err == nil {
+				continue
+			}
+			if _, err := netip.ParseAddr(entry); err != nil {
+				errs = append(errs, fmt.Errorf("%s entry %q is not an IP address or CIDR range", list.path, entry))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
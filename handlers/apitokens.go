@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"watcher/response"
+	"watcher/store"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// apiTokenPrefix makes personal API tokens easy to recognise in scripts and logs.
+const apiTokenPrefix = "gofs_"
+
+// scopeAll grants a token access to every route its owner's role allows. Only
+// supervisors may mint it.
+const scopeAll = "*"
+
+// APIToken is a personal API token as kept in the session store. The token itself
+// is only returned once, when minted; the store holds its SHA-256 hash.
+type APIToken struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"` // route names, see permissions in config.yaml
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	User      AuthData  `json:"user"`
+}
+
+// CreateAPITokenRequest is the payload of POST /auth/tokens.
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// apiTokenKey is the store key of a token, addressed by the hash of its secret.
+func apiTokenKey(hash string) string {
+	return "api_token:" + hash
+}
+
+// apiTokenIndexKey is the hash mapping a NIP's token IDs to token hashes.
+func apiTokenIndexKey(nip string) string {
+	return "api_tokens:" + nip
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// bearerToken returns the token from an "Authorization: Bearer" header, if any.
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[7:])
+	return token, token != ""
+}
+
+// lookupAPIToken resolves a bearer token to its stored record.
+func (app *App) lookupAPIToken(ctx context.Context, token string) (*APIToken, error) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return nil, fmt.Errorf("malformed API token")
+	}
+
+	val, err := app.Sessions.Get(ctx, apiTokenKey(hashAPIToken(token)))
+	if err == store.ErrNotFound {
+		return nil, fmt.Errorf("API token not found or expired")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API token: %w", err)
+	}
+
+	var apiToken APIToken
+	if err := json.Unmarshal([]byte(val), &apiToken); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal API token: %w", err)
+	}
+	return &apiToken, nil
+}
+
+// allowsRoute reports whether the token's scopes cover the matched route.
+func (t *APIToken) allowsRoute(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	name := ""
+	if route != nil {
+		name = route.GetName()
+	}
+
+	for _, scope := range t.Scopes {
+		if scope == scopeAll || (name != "" && scope == name) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticateAPIToken validates a bearer token for the current route and
+// returns the AuthData of its owner, or the error code to answer with.
+func (app *App) authenticateAPIToken(r *http.Request, token string) (*AuthData, response.Code, error) {
+	apiToken, err := app.lookupAPIToken(r.Context(), token)
+	if err != nil {
+		return nil, response.CodeUnauthorized, err
+	}
+	if !apiToken.allowsRoute(r) {
+		return nil, response.CodeForbidden, fmt.Errorf("API token %q is not scoped for this route", apiToken.Name)
+	}
+
+	authData := apiToken.User
+	return &authData, "", nil
+}
+
+// CreateAPITokenHandler mints a personal API token for the logged-in user. The
+// token is shown once in the response and only its hash is kept.
+func (app *App) CreateAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	if isAPITokenRequest(r) {
+		response.Error(w, r, response.CodeForbidden, "Forbidden: API tokens cannot mint other tokens")
+		return
+	}
+
+	authData, err := app.currentAuthData(r)
+	if err != nil {
+		response.Error(w, r, response.CodeUnauthorized, err.Error())
+		return
+	}
+
+	var req CreateAPITokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, r, response.CodeInvalidRequest, "Invalid request payload")
+		return
+	}
+
+	if strings.TrimSpace(req.Name) == "" || len(req.Scopes) == 0 {
+		response.Error(w, r, response.CodeInvalidRequest, "Name and at least one scope are required")
+		return
+	}
+
+	// a misspelt scope would mint a token that matches nothing
+	routes := app.routeNames()
+	var unknown []string
+	for _, scope := range req.Scopes {
+		if scope == scopeAll {
+			if !hasRole(authData, []string{RoleSupervisor}) {
+				response.Error(w, r, response.CodeForbidden, "Forbidden: only supervisors may create tokens with scope \"*\"")
+				return
+			}
+		} else if !routes[scope] {
+			unknown = append(unknown, scope)
+		}
+	}
+	if len(unknown) > 0 {
+		response.Error(w, r, response.CodeInvalidRequest, fmt.Sprintf("Unknown scopes %s, scopes are route names", strings.Join(unknown, ", ")))
+		return
+	}
+
+	lifetime := app.Config().APITokens.DefaultLifetime
+	if req.ExpiresInDays > 0 {
+		lifetime = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	}
+	if lifetime > app.Config().APITokens.MaxLifetime {
+		response.Error(w, r, response.CodeInvalidRequest, fmt.Sprintf("Token lifetime cannot exceed %s", app.Config().APITokens.MaxLifetime))
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		response.Internal(w, r, "Failed to generate token", err)
+		return
+	}
+	token := apiTokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	hash := hashAPIToken(token)
+
+	now := time.Now()
+	apiToken := APIToken{
+		ID:        uuid.New().String(),
+		Name:      strings.TrimSpace(req.Name),
+		Scopes:    req.Scopes,
+		CreatedAt: now,
+		ExpiresAt: now.Add(lifetime),
+		User:      *authData,
+	}
+
+	tokenJSON, err := json.Marshal(apiToken)
+	if err != nil {
+		response.Internal(w, r, "Failed to marshal token", err)
+		return
+	}
+
+	ctx := r.Context()
+	err = app.Sessions.Atomic(ctx, func(tx store.Writer) error {
+		tx.Set(ctx, apiTokenKey(hash), string(tokenJSON), lifetime)
+		tx.HSet(ctx, apiTokenIndexKey(authData.NIP), map[string]string{apiToken.ID: hash})
+		return nil
+	})
+	if err != nil {
+		response.Internal(w, r, "Failed to store token", err)
+		return
+	}
+
+	response.Created(w, r, "Store this token now, it will not be shown again", map[string]any{"token": token, "info": apiToken})
+}
+
+// ListAPITokensHandler lists the logged-in user's API tokens without their secrets.
+func (app *App) ListAPITokensHandler(w http.ResponseWriter, r *http.Request) {
+	authData, err := app.currentAuthData(r)
+	if err != nil {
+		response.Error(w, r, response.CodeUnauthorized, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	index, err := app.Sessions.HGetAll(ctx, apiTokenIndexKey(authData.NIP))
+	if err != nil {
+		response.Internal(w, r, "Failed to read token index", err)
+		return
+	}
+
+	tokens := make([]APIToken, 0, len(index))
+	for id, hash := range index {
+		val, err := app.Sessions.Get(ctx, apiTokenKey(hash))
+		if err == store.ErrNotFound {
+			// expired, drop it from the index
+			app.Sessions.HDel(ctx, apiTokenIndexKey(authData.NIP), id)
+			continue
+		}
+		if err != nil {
+			response.Internal(w, r, "Failed to get token", err)
+			return
+		}
+
+		var apiToken APIToken
+		if err := json.Unmarshal([]byte(val), &apiToken); err != nil {
+			continue
+		}
+		tokens = append(tokens, apiToken)
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+
+	response.OK(w, r, "", tokens)
+}
+
+// RevokeAPITokenHandler deletes one of the logged-in user's API tokens.
+func (app *App) RevokeAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	authData, err := app.currentAuthData(r)
+	if err != nil {
+		response.Error(w, r, response.CodeUnauthorized, err.Error())
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	ctx := r.Context()
+
+	hash, err := app.Sessions.HGet(ctx, apiTokenIndexKey(authData.NIP), id)
+	if err == store.ErrNotFound {
+		response.Error(w, r, response.CodeNotFound, "API token not found")
+		return
+	}
+	if err != nil {
+		response.Internal(w, r, "Failed to read token index", err)
+		return
+	}
+
+	err = app.Sessions.Atomic(ctx, func(tx store.Writer) error {
+		tx.Del(ctx, apiTokenKey(hash))
+		tx.HDel(ctx, apiTokenIndexKey(authData.NIP), id)
+		return nil
+	})
+	if err != nil {
+		response.Internal(w, r, "Failed to revoke token", err)
+		return
+	}
+
+	response.OK(w, r, "API token revoked", nil)
+}
+
+// revokeUserAPITokens deletes every API token of a NIP and returns how many were removed.
+func (app *App) revokeUserAPITokens(ctx context.Context, nip string) (int, error) {
+	index, err := app.Sessions.HGetAll(ctx, apiTokenIndexKey(nip))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read token index: %w", err)
+	}
+
+	keys := []string{apiTokenIndexKey(nip)}
+	for _, hash := range index {
+		keys = append(keys, apiTokenKey(hash))
+	}
+
+	if err := app.Sessions.Del(ctx, keys...); err != nil {
+		return 0, fmt.Errorf("failed to delete API tokens: %w", err)
+	}
+	return len(index), nil
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCreateAPITokenScopes(t *testing.T) {
+	app := newTestApp(t, &fakeDB{})
+	srv := httptest.NewServer(app.Handler())
+	defer srv.Close()
+
+	reviewer := &AuthData{UserID: "u2", Name: "Reviewer", Role: RoleReviewer, NIP: testTargetNIP}
+	tests := []struct {
+		name       string
+		user       *AuthData
+		scopes     []string
+		wantStatus int
+		wantCode   string
+	}{
+		{"route names", reviewer, []string{"outbox.get", "docvault.get"}, http.StatusCreated, ""},
+		{"misspelt route", reviewer, []string{"outbox.get", "outbox.gte"}, http.StatusBadRequest, "invalid_request"},
+		{"all routes by a reviewer", reviewer, []string{scopeAll}, http.StatusForbidden, "forbidden"},
+		{"all routes by a supervisor", testSupervisor(), []string{scopeAll}, http.StatusCreated, ""},
+	}
+	for _, tt := range tests {
+		cookie, csrf := newTestSession(t, app, tt.user)
+		body := CreateAPITokenRequest{Name: tt.name, Scopes: tt.scopes}
+		status, env := doJSON(t, http.DefaultClient, "POST", srv.URL+"/auth/tokens", body, sessionHeader(cookie, csrf))
+		if status != tt.wantStatus || env.Code != tt.wantCode {
+			t.Errorf("%s: create token = %d %q, want %d %q", tt.name, status, env.Code, tt.wantStatus, tt.wantCode)
+		}
+	}
+}
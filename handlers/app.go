@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"sync"
+	"watcher/config"
+)
+
+// App holds the configuration, stores and database pools the handlers work
+// with. Handlers are methods on App, so a test can build one around a
+// MemoryStore and serve App.Router with httptest.
+type App struct {
+	*config.Services
+
+	authenticatorMu sync.RWMutex
+	authenticator   Authenticator // backend selected by auth.backend in config.yaml
+
+	ghostscript cachedCheck // result of the last Ghostscript readiness check
+}
+
+// NewApp returns an App using services and the credential backend they configure.
+func NewApp(services *config.Services) (*App, error) {
+	app := &App{Services: services}
+	if err := app.InitAuthenticator(); err != nil {
+		return nil, err
+	}
+	return app, nil
+}
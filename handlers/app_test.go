@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"watcher/config"
+	"watcher/store"
+)
+
+// fakeQuery answers a query of fakeDB with columns and rows.
+type fakeQuery func(query string, args []driver.NamedValue) (columns []string, rows [][]driver.Value, err error)
+
+// fakeExec answers an exec of fakeDB with the number of rows affected.
+type fakeExec func(query string, args []driver.NamedValue) (int64, error)
+
+// fakeDB is a database/sql connector whose queries are answered by a Go
+// function, so handler tests can run without MySQL. Execs are recorded and,
+// unless exec is set, affect one row.
+type fakeDB struct {
+	query fakeQuery
+	exec  fakeExec
+
+	mu    sync.Mutex
+	execs []string
+}
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{db}, nil }
+func (db *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fakeDB: prepared statements are not supported")
+}
+func (c fakeConn) Close() error { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("fakeDB: transactions are not supported")
+}
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	columns, rows, err := c.db.query(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: columns, rows: rows}, nil
+}
+
+func (c fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.execs = append(c.db.execs, query)
+	if c.db.exec == nil {
+		return driver.RowsAffected(1), nil
+	}
+	affected, err := c.db.exec(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(affected), nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// testConfig is the config file of newTestApp.
+const testConfig = `
+session:
+  store: memory
+mysql:
+  doctracer:
+    user: test
+    host: 127.0.0.1
+    port: "3306"
+    database: doctracer
+`
+
+// writeTestConfig writes content to a config file in a temporary directory.
+func writeTestConfig(t *testing.T, content string) string {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return configPath
+}
+
+// newTestApp builds an App the way main does, from a config file, with a
+// MemoryStore for sessions and db standing in for doctracer.
+func newTestApp(t *testing.T, db *fakeDB) *App {
+	t.Helper()
+	cfg, err := config.Load(writeTestConfig(t, testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	services := config.NewServices(cfg)
+	sessions := store.NewMemoryStore(time.Minute)
+	services.SetSessionStore(sessions)
+	doctracer := sql.OpenDB(db)
+	services.SetDatabase("doctracer", doctracer)
+	t.Cleanup(func() {
+		sessions.Close()
+		doctracer.Close()
+	})
+
+	app, err := NewApp(services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+// newTestSession stores a session for user the way a login does and returns
+// its cookie and CSRF token.
+func newTestSession(t *testing.T, app *App, user *AuthData) (*http.Cookie, string) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/auth/login", nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	rec := httptest.NewRecorder()
+	token, csrf, err := app.createSession(rec, req, user, app.Config().Session.AbsoluteLifetime, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Cookie{Name: "session_token", Value: token}, csrf
+}
+
+// envelope is the response body of every JSON route, see package response.
+type envelope struct {
+	Status bool            `json:"status"`
+	Code   string          `json:"code"`
+	Data   json.RawMessage `json:"data"`
+}
+
+func doJSON(t *testing.T, client *http.Client, method, url string, body any, header http.Header) (int, envelope) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var env envelope
+	if err := json.NewDecoder(res.Body).Decode(&env); err != nil {
+		t.Fatalf("%s %s: decoding response: %v", method, url, err)
+	}
+	return res.StatusCode, env
+}
+
+func TestLoginSessionLogout(t *testing.T) {
+	const nip = "198001012000011001"
+	hash, err := HashPassword("right-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &fakeDB{query: func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		switch {
+		case strings.Contains(query, "FROM users WHERE nip = ?"):
+			columns := []string{"user_id", "role", "name", "nip", "jabatan", "department_id", "password"}
+			if args[0].Value != nip {
+				return columns, nil, nil
+			}
+			return columns, [][]driver.Value{{"u1", RoleReviewer, "Test User", nip, "Pelaksana", "D01", hash}}, nil
+		case strings.Contains(query, "FROM user_totp"):
+			return []string{"nip", "secret", "enabled", "recovery_codes"}, nil, nil // not enrolled
+		}
+		return nil, nil, errors.New("unexpected query: " + query)
+	}}
+	srv := httptest.NewServer(newTestApp(t, db).Handler())
+	defer srv.Close()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Jar: jar}
+
+	status, env := doJSON(t, client, "POST", srv.URL+"/auth/login", LoginRequest{NIP: nip, Password: "wrong-password"}, nil)
+	if status != http.StatusUnauthorized || env.Code != "invalid_credentials" {
+		t.Fatalf("login with a wrong password = %d %q, want 401 invalid_credentials", status, env.Code)
+	}
+
+	status, env = doJSON(t, client, "POST", srv.URL+"/auth/login", LoginRequest{NIP: nip, Password: "right-password"}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("login = %d %q, want 200", status, env.Code)
+	}
+	var login struct {
+		CSRFToken string `json:"csrf_token"`
+	}
+	if err := json.Unmarshal(env.Data, &login); err != nil || login.CSRFToken == "" {
+		t.Fatalf("login data %s has no csrf_token", env.Data)
+	}
+
+	status, env = doJSON(t, client, "GET", srv.URL+"/auth/session", nil, nil)
+	if status != http.StatusOK {
+		t.Fatalf("session = %d %q, want 200", status, env.Code)
+	}
+	var session struct {
+		NIP       string `json:"nip"`
+		Role      string `json:"role"`
+		CSRFToken string `json:"csrf_token"`
+	}
+	if err := json.Unmarshal(env.Data, &session); err != nil {
+		t.Fatal(err)
+	}
+	if session.NIP != nip || session.Role != RoleReviewer || session.CSRFToken != login.CSRFToken {
+		t.Errorf("session data = %s, want nip %s, role %s and the login's csrf_token", env.Data, nip, RoleReviewer)
+	}
+
+	status, env = doJSON(t, client, "POST", srv.URL+"/auth/logout", nil, nil)
+	if status != http.StatusForbidden || env.Code != "csrf_invalid" {
+		t.Fatalf("logout without X-CSRF-Token = %d %q, want 403 csrf_invalid", status, env.Code)
+	}
+
+	status, env = doJSON(t, client, "POST", srv.URL+"/auth/logout", nil, http.Header{"X-Csrf-Token": {login.CSRFToken}})
+	if status != http.StatusOK {
+		t.Fatalf("logout = %d %q, want 200", status, env.Code)
+	}
+
+	status, env = doJSON(t, client, "GET", srv.URL+"/auth/session", nil, nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("session after logout = %d %q, want 401", status, env.Code)
+	}
+}
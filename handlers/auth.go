@@ -2,18 +2,20 @@ package handlers
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
-	"watcher/config"
+	"watcher/logging"
+	"watcher/metrics"
+	"watcher/response"
+	"watcher/store"
 
-	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 )
 
-// AuthData represents the structure of the authentication data stored in Redis
+// AuthData represents the structure of the authentication data stored in the session store
 type AuthData struct {
 	UserID       string `json:"user_id"`
 	Name         string `json:"name"`
@@ -21,8 +23,13 @@ type AuthData struct {
 	NIP          string `json:"nip"`
 	DepartmentID string `json:"department_id"`
 	Jabatan      string `json:"jabatan"`
-	IP           string `json:"ip"`
-	IPvX         string `json:"ipvx"`
+	IP           string `json:"ip"`   // client address without port, resolved through trusted proxies
+	IPvX         string `json:"ipvx"` // "IPv4" or "IPv6"; was the peer address with port before proxy support
+	IPv4         string `json:"ipv4,omitempty"`
+	IPv6         string `json:"ipv6,omitempty"`
+
+	// ImpersonatedBy is the supervisor behind an impersonation session, nil otherwise
+	ImpersonatedBy *AuthData `json:"impersonated_by,omitempty"`
 }
 
 // LoginRequest represents the structure of the login request payload
@@ -34,12 +41,12 @@ type LoginRequest struct {
 type contextKey string
 
 const (
-	AuthContextKey contextKey = "auth"
+	AuthContextKey     contextKey = "auth"
+	APITokenContextKey contextKey = "api_token" // true when authenticated by bearer token
 )
 
-// getSessionDataFromRedis retrieves session data from Redis using the session token from cookies.
-func getSessionDataFromRedis(r *http.Request) (*AuthData, error) {
-	print("auth middleware accessed! \n")
+// getSessionData retrieves session data from the session store using the session token from cookies.
+func (app *App) getSessionData(r *http.Request) (*AuthData, error) {
 	// client cookie side = session_token
 	cookie, err := r.Cookie("session_token")
 	if err != nil {
@@ -48,15 +55,14 @@ func getSessionDataFromRedis(r *http.Request) (*AuthData, error) {
 	}
 	sessionToken := cookie.Value
 
-	print("cookie found:", sessionToken)
 	// if token exist, match session_token in redisDB
-	ctx := context.Background()                                    // ctx is required when making redis Get() call                              // empty context - no call time limit
-	val, err := config.RedisClient.Get(ctx, sessionToken).Result() // Use sessionToken directly as key
-	if err == redis.Nil {
-		return nil, fmt.Errorf("session not found in Redis")
+	ctx := context.Background() // no deadline of its own; the store client's timeouts bound the lookup
+	val, err := app.Sessions.Get(ctx, sessionKey(sessionToken))
+	if err == store.ErrNotFound {
+		return nil, fmt.Errorf("session not found")
 	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get session from Redis: %w", err)
+		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
 
 	var authData AuthData
@@ -68,97 +74,199 @@ func getSessionDataFromRedis(r *http.Request) (*AuthData, error) {
 	return &authData, nil
 }
 
-// AuthMiddleware checks for a valid session token and authenticates the request.
-func AuthMiddleware(next http.Handler) http.Handler {
+// AuthMiddleware checks for a valid session token, or a personal API token in an
+// Authorization: Bearer header, and authenticates the request.
+func (app *App) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authData, err := getSessionDataFromRedis(r)
+		if token, ok := bearerToken(r); ok {
+			authData, code, err := app.authenticateAPIToken(r, token)
+			if err != nil {
+				response.Error(w, r, code, http.StatusText(code.HTTPStatus())+": "+err.Error())
+				return
+			}
+
+			logging.SetUser(r.Context(), authData.NIP)
+			ctx := context.WithValue(r.Context(), AuthContextKey, authData)
+			ctx = context.WithValue(ctx, APITokenContextKey, true)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		authData, err := app.getSessionData(r)
 		if err != nil {
-			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			response.Error(w, r, response.CodeUnauthorized, "Unauthorized: "+err.Error())
+			return
+		}
+
+		// reject a session used from outside the address or subnet it was created from
+		cookie, _ := r.Cookie("session_token")
+		if !app.sessionIPMatches(authData, r) {
+			logging.From(r.Context()).Warn("session used from another address", "nip", authData.NIP, "ip", app.clientIP(r), "bound_ip", authData.IP)
+			response.Error(w, r, response.CodeUnauthorized, "Unauthorized: session is bound to another network address")
+			return
+		}
+
+		// slide the idle timeout forward, bounded by the absolute lifetime
+		if err := app.refreshSession(r.Context(), w, cookie.Value, authData); err != nil {
+			response.Error(w, r, response.CodeUnauthorized, "Unauthorized: "+err.Error())
+			return
+		}
+
+		// impersonation sessions may look but not change anything
+		if !impersonationAllows(authData, r) {
+			app.auditImpersonation(r.Context(), authData.ImpersonatedBy.NIP, authData.NIP, "blocked", r.Method+" "+r.URL.Path, app.clientIP(r))
+			response.Error(w, r, response.CodeForbidden, "Forbidden: not allowed while impersonating")
 			return
 		}
 
 		// Store AuthData in request context
+		logging.SetUser(r.Context(), authData.NIP)
 		ctx := context.WithValue(r.Context(), AuthContextKey, authData)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-// GetSessionHandler checks for an existing session in Redis and returns the authentication data.
-func GetSessionHandler(w http.ResponseWriter, r *http.Request) {
-	authData, err := getSessionDataFromRedis(r)
+// SessionResponse is the data of /auth/session: the AuthData fields at the top
+// level, as before CSRF tokens were added, plus the session's CSRF token.
+type SessionResponse struct {
+	*AuthData
+	CSRFToken     string `json:"csrf_token"`
+	Impersonating bool   `json:"impersonating"`
+}
+
+// GetSessionHandler checks for an existing session and returns the authentication data.
+func (app *App) GetSessionHandler(w http.ResponseWriter, r *http.Request) {
+	authData, err := app.getSessionData(r)
+	if err != nil {
+		response.Error(w, r, response.CodeUnauthorized, err.Error())
+		return
+	}
+
+	// the frontend reads the CSRF token here after a page reload
+	cookie, _ := r.Cookie("session_token")
+	csrf, _, err := app.sessionCSRFToken(r.Context(), cookie.Value)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		response.Internal(w, r, "Failed to read session", err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	response := map[string]any{"status": true, "data": authData}
-	json.NewEncoder(w).Encode(response)
+	response.OK(w, r, "", SessionResponse{
+		AuthData:      authData,
+		CSRFToken:     csrf,
+		Impersonating: authData.ImpersonatedBy != nil,
+	})
 }
 
 // LoginHandler handles user login requests
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
+func (app *App) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	var req LoginRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		response.Error(w, r, response.CodeInvalidRequest, "Invalid request payload")
 		return
 	}
 
-	// 1. Query MySQL to validate credentials
-	var user AuthData // Re-using AuthData struct for user info
-	query := "SELECT user_id, role, name, nip, jabatan, department_id FROM users WHERE nip = ? AND password = ?"
-	row := config.DB["doctracer"].QueryRow(query, req.NIP, req.Password)
-	err = row.Scan(&user.UserID, &user.Role, &user.Name, &user.NIP, &user.Jabatan, &user.DepartmentID)
+	// refuse early while the NIP or client IP is delayed or locked out
+	if !app.checkLoginThrottle(w, r, req.NIP) {
+		metrics.Logins.WithLabelValues("throttled").Inc()
+		return
+	}
 
-	if err == sql.ErrNoRows {
-		http.Error(w, "Invalid NIP or password", http.StatusUnauthorized)
+	// 1. Validate credentials with the configured backend (MySQL or LDAP)
+	user, err := app.currentAuthenticator().Authenticate(r.Context(), req.NIP, req.Password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		app.recordLoginFailures(r, req.NIP)
+		metrics.Logins.WithLabelValues("invalid_credentials").Inc()
+		response.Error(w, r, response.CodeInvalidCredentials, "Invalid NIP or password")
 		return
 	}
 
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
+		metrics.Logins.WithLabelValues("error").Inc()
+		response.Internal(w, r, "Authentication error", err)
 		return
 	}
 
-	// 2. Generate Session Token
+	logging.SetUser(r.Context(), user.NIP)
+	// Only the NIP's failures are cleared. The client IP keeps its count, or
+	// anyone holding one valid account could reset the per-IP limit between
+	// guesses at other NIPs; max_attempts_ip is sized for offices behind NAT.
+	if err := app.clearLoginFailures(r.Context(), loginScopeNIP, req.NIP); err != nil {
+		logging.From(r.Context()).Error("failed to clear login failures", "error", err)
+	}
+
+	// 2. Hold the session back until the second factor is verified
+	enrolled, required, err := app.twoFactorStatus(r.Context(), user)
+	if err != nil {
+		response.Internal(w, r, "Failed to check two-factor status", err)
+		return
+	}
+	if enrolled || required {
+		app.writeTwoFactorChallenge(w, r, user, enrolled)
+		return
+	}
+
+	// 3. Create the session and cookie
+	csrf, err := app.startSession(w, r, user)
+	if err != nil {
+		response.Internal(w, r, "Failed to create session", err)
+		return
+	}
+
+	// 4. Respond with the CSRF token to send in X-CSRF-Token on POST/PUT/DELETE
+	response.OK(w, r, "Login successful", map[string]any{"csrf_token": csrf})
+}
+
+// startSession stores a new session for the user, sets the
+// session_token cookie and returns the session's CSRF token. It completes
+// a login and counts it as successful.
+func (app *App) startSession(w http.ResponseWriter, r *http.Request, user *AuthData) (string, error) {
+	_, csrf, err := app.createSession(w, r, user, app.Config().Session.AbsoluteLifetime, nil)
+	if err != nil {
+		metrics.Logins.WithLabelValues("error").Inc()
+		return "", err
+	}
+	metrics.Logins.WithLabelValues("success").Inc()
+	return csrf, nil
+}
+
+// createSession stores a session with the given absolute lifetime and extra
+// metadata, sets the cookie and returns the session and CSRF tokens.
+func (app *App) createSession(w http.ResponseWriter, r *http.Request, user *AuthData, lifetime time.Duration, meta map[string]string) (string, string, error) {
+	// 1. Generate Session and CSRF Tokens
 	sessionToken := uuid.New().String()
-	sessionKey := sessionToken // Store sessionToken directly as the key
 
-	// Populate IP addresses (can be improved with actual IP detection)
-	user.IP = r.RemoteAddr   // Basic remote address
-	user.IPvX = r.RemoteAddr // Placeholder, actual IPvX detection is more complex
+	csrf, err := generateCSRFToken()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate CSRF token: %w", err)
+	}
+
+	// Populate IP addresses, looking through trusted reverse proxies
+	app.setClientIP(user, r)
 
-	// Marshal user data to JSON for Redis
+	// Marshal user data to JSON for the session store
 	userDataJSON, err := json.Marshal(user)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to marshal user data: %v", err), http.StatusInternalServerError)
-		return
+		return "", "", fmt.Errorf("failed to marshal user data: %w", err)
 	}
 
-	// 3. Store Session in Redis (e.g., expire after 24 hours)
+	// 2. Store Session, expiring after the idle timeout unless renewed
 	ctx := context.Background()
-	err = config.RedisClient.Set(ctx, sessionKey, userDataJSON, 24*time.Hour).Err()
+	idleTimeout := app.Config().Session.IdleTimeout
+	if idleTimeout > lifetime {
+		idleTimeout = lifetime
+	}
+	err = app.Sessions.Set(ctx, sessionKey(sessionToken), string(userDataJSON), idleTimeout)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to store session in Redis: %v", err), http.StatusInternalServerError)
-		return
+		return "", "", fmt.Errorf("failed to store session: %w", err)
 	}
 
-	// 4. Set HTTP-only Cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    sessionToken,
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: true,
-		Secure:   false, // vscode client
-		// Secure:   true, // if using real client
-		Path: "/", // use cookies on all path
-	})
+	// index the session under its owner's NIP so it can be listed and revoked
+	if err := app.registerSession(ctx, sessionToken, csrf, *user, r, lifetime, meta); err != nil {
+		return "", "", fmt.Errorf("failed to index session: %w", err)
+	}
 
-	// 5. Respond
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	response := map[string]any{"status": true, "message": "Login successful"}
-	json.NewEncoder(w).Encode(response)
+	// 3. Set HTTP-only Cookie
+	setSessionCookie(w, sessionToken, time.Now().Add(idleTimeout))
+	return sessionToken, csrf, nil
 }
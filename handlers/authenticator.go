@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"watcher/config"
+	"watcher/logging"
+)
+
+// ErrInvalidCredentials is returned by an Authenticator when the NIP is unknown
+// or the password does not match.
+var ErrInvalidCredentials = errors.New("invalid NIP or password")
+
+// Authenticator verifies a NIP and password and returns the user's AuthData.
+// IP fields are filled in by LoginHandler, not by the Authenticator.
+type Authenticator interface {
+	Authenticate(ctx context.Context, nip, password string) (*AuthData, error)
+}
+
+func (app *App) currentAuthenticator() Authenticator {
+	app.authenticatorMu.RLock()
+	defer app.authenticatorMu.RUnlock()
+	return app.authenticator
+}
+
+// InitAuthenticator selects the credential backend configured in config.yaml.
+func (app *App) InitAuthenticator() error {
+	cfg := app.Config().Auth
+	selected, err := app.newAuthenticator(cfg)
+	if err != nil {
+		return err
+	}
+	app.setAuthenticator(selected, cfg.Backend)
+	return nil
+}
+
+func (app *App) newAuthenticator(cfg config.AuthConfig) (Authenticator, error) {
+	switch cfg.Backend {
+	case "mysql":
+		return &MySQLAuthenticator{app: app}, nil
+	case "ldap":
+		ldapAuth := NewLDAPAuthenticator(cfg.LDAP)
+		ldapAuth.Deactivated = app.userDeactivated
+		return ldapAuth, nil
+	}
+	return nil, fmt.Errorf("unknown auth backend %q", cfg.Backend)
+}
+
+func (app *App) setAuthenticator(selected Authenticator, backend string) {
+	app.authenticatorMu.Lock()
+	app.authenticator = selected
+	app.authenticatorMu.Unlock()
+	slog.Info("authenticator selected", "backend", backend)
+}
+
+// Reload applies the config file as Services.Reload does and, when the auth
+// section changed, swaps the authenticator in the same locked step, so no
+// reload can pair the new configuration with a stale backend.
+func (app *App) Reload(configPath string) ([]string, error) {
+	return app.Services.Reload(configPath, func(old, cfg *config.Config) (func(), error) {
+		if reflect.DeepEqual(old.Auth, cfg.Auth) {
+			return nil, nil
+		}
+		selected, err := app.newAuthenticator(cfg.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("auth: %w", err)
+		}
+		return func() { app.setAuthenticator(selected, cfg.Auth.Backend) }, nil
+	})
+}
+
+// MySQLAuthenticator checks credentials against the users table of the
+// doctracer database.
+type MySQLAuthenticator struct {
+	app *App
+}
+
+func (a *MySQLAuthenticator) Authenticate(ctx context.Context, nip, password string) (*AuthData, error) {
+	db := a.app.Database("doctracer")
+	if db == nil {
+		return nil, fmt.Errorf("database 'doctracer' is not connected")
+	}
+
+	var user AuthData // Re-using AuthData struct for user info
+	var storedPassword string
+	query := "SELECT user_id, role, name, nip, jabatan, department_id, password FROM users WHERE nip = ? AND active = TRUE"
+	row := db.QueryRowContext(ctx, query, nip)
+	err := row.Scan(&user.UserID, &user.Role, &user.Name, &user.NIP, &user.Jabatan, &user.DepartmentID, &storedPassword)
+
+	if err == sql.ErrNoRows {
+		// compare against a dummy hash so unknown NIPs take as long as known ones
+		verifyPassword(dummyPasswordHash(), password)
+		return nil, ErrInvalidCredentials
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	ok, needsRehash := verifyPassword(storedPassword, password)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	// upgrade legacy plaintext (or weaker) passwords to a fresh hash
+	if needsRehash {
+		if err := a.app.upgradePasswordHash(user.UserID, password); err != nil {
+			logging.From(ctx).Error("failed to upgrade password hash", "user_id", user.UserID, "error", err)
+		}
+	}
+
+	return &user, nil
+}
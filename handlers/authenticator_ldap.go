@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+	"watcher/config"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldapConn is the subset of *ldap.Conn used by LDAPAuthenticator, so tests can
+// swap in an in-process fake directory.
+type ldapConn interface {
+	Bind(username, password string) error
+	Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// LDAPAuthenticator checks credentials by binding to an LDAP or Active Directory
+// server as the user, after finding the user's DN with a service account.
+type LDAPAuthenticator struct {
+	Config config.LDAPConfig
+	// Dial opens a connection to the directory; replaceable for tests.
+	Dial func(cfg config.LDAPConfig) (ldapConn, error)
+	// Deactivated reports whether a NIP was deactivated in the local users
+	// table, which the directory knows nothing about. Nil skips the check.
+	Deactivated func(ctx context.Context, nip string) (bool, error)
+}
+
+// NewLDAPAuthenticator returns an LDAPAuthenticator dialing the configured server.
+func NewLDAPAuthenticator(cfg config.LDAPConfig) *LDAPAuthenticator {
+	return &LDAPAuthenticator{Config: cfg, Dial: dialLDAP}
+}
+
+func dialLDAP(cfg config.LDAPConfig) (ldapConn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+
+	conn, err := ldap.DialURL(cfg.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP: %w", err)
+	}
+	conn.SetTimeout(cfg.Timeout)
+
+	if cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, nip, password string) (*AuthData, error) {
+	// an empty password would turn the user bind into an anonymous bind
+	if nip == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.Dial(a.Config)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// 1. Look the user up with the service account
+	if a.Config.BindDN != "" {
+		if err := conn.Bind(a.Config.BindDN, a.Config.BindPassword); err != nil {
+			return nil, fmt.Errorf("failed to bind LDAP service account: %w", err)
+		}
+	}
+
+	attrs := a.Config.Attributes
+	wanted := []string{"dn", "memberOf", attrs.UserID, attrs.Name, attrs.NIP, attrs.Jabatan, attrs.DepartmentID}
+	if attrs.Role != "" {
+		wanted = append(wanted, attrs.Role)
+	}
+
+	search := ldap.NewSearchRequest(
+		a.Config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(a.Config.Timeout.Seconds()), false,
+		fmt.Sprintf(a.Config.UserFilter, ldap.EscapeFilter(nip)),
+		wanted,
+		nil,
+	)
+	result, err := conn.Search(search)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search LDAP: %w", err)
+	}
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	// 2. Verify the password by binding as the user
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("failed to bind LDAP user: %w", err)
+	}
+
+	// 3. Map directory attributes into AuthData
+	user := &AuthData{
+		UserID:       entry.GetAttributeValue(attrs.UserID),
+		Name:         entry.GetAttributeValue(attrs.Name),
+		NIP:          entry.GetAttributeValue(attrs.NIP),
+		Jabatan:      entry.GetAttributeValue(attrs.Jabatan),
+		DepartmentID: entry.GetAttributeValue(attrs.DepartmentID),
+		Role:         a.roleFor(entry),
+	}
+	if user.NIP == "" {
+		user.NIP = nip
+	}
+	if user.UserID == "" {
+		user.UserID = user.NIP
+	}
+	if user.Role == "" {
+		return nil, errors.New("no role could be determined for LDAP user")
+	}
+
+	// 4. Honour deactivation by a supervisor
+	if a.Deactivated != nil {
+		deactivated, err := a.Deactivated(ctx, user.NIP)
+		if err != nil {
+			return nil, err
+		}
+		if deactivated {
+			return nil, ErrInvalidCredentials
+		}
+	}
+	return user, nil
+}
+
+// roleFor reads the role attribute if configured, otherwise maps group
+// membership through group_roles, falling back to default_role.
+func (a *LDAPAuthenticator) roleFor(entry *ldap.Entry) string {
+	if a.Config.Attributes.Role != "" {
+		if role := entry.GetAttributeValue(a.Config.Attributes.Role); role != "" {
+			return role
+		}
+	}
+
+	// a member of several mapped groups gets the most privileged role
+	matched := make(map[string]bool)
+	for _, group := range entry.GetAttributeValues("memberOf") {
+		for groupDN, role := range a.Config.GroupRoles {
+			if strings.EqualFold(group, groupDN) {
+				matched[role] = true
+			}
+		}
+	}
+	for _, role := range []string{RoleSupervisor, RoleReviewer, RoleContributor} {
+		if matched[role] {
+			return role
+		}
+	}
+	for role := range matched {
+		return role
+	}
+	return a.Config.DefaultRole
+}
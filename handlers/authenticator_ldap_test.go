@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"watcher/config"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	testServiceDN       = "cn=readonly,dc=example,dc=org"
+	testServicePassword = "service-secret"
+	testSupervisorGroup = "cn=supervisors,ou=groups,dc=example,dc=org"
+	testReviewerGroup   = "cn=reviewers,ou=groups,dc=example,dc=org"
+)
+
+// fakeUser is an entry of fakeDirectory with its password.
+type fakeUser struct {
+	entry    *ldap.Entry
+	password string
+}
+
+// fakeDirectory is an in-process ldapConn holding users by DN. Search
+// understands the (employeeID=%s) filter of testLDAPConfig only.
+type fakeDirectory struct {
+	users map[string]fakeUser
+	bound string // DN of the last successful bind
+}
+
+func (d *fakeDirectory) Bind(username, password string) error {
+	if username == testServiceDN && password == testServicePassword {
+		d.bound = username
+		return nil
+	}
+	if user, ok := d.users[username]; ok && user.password == password {
+		d.bound = username
+		return nil
+	}
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+}
+
+func (d *fakeDirectory) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	if d.bound != testServiceDN {
+		return nil, ldap.NewError(ldap.LDAPResultInsufficientAccessRights, errors.New("search requires the service account"))
+	}
+	result := &ldap.SearchResult{}
+	for _, user := range d.users {
+		if req.Filter == fmt.Sprintf("(employeeID=%s)", user.entry.GetAttributeValue("employeeID")) {
+			result.Entries = append(result.Entries, user.entry)
+		}
+	}
+	return result, nil
+}
+
+func (d *fakeDirectory) Close() error { return nil }
+
+func (d *fakeDirectory) add(nip, password string, groups ...string) {
+	dn := "uid=" + nip + ",ou=people,dc=example,dc=org"
+	d.users[dn] = fakeUser{
+		entry: ldap.NewEntry(dn, map[string][]string{
+			"sAMAccountName":   {"user" + nip},
+			"displayName":      {"User " + nip},
+			"employeeID":       {nip},
+			"title":            {"Pelaksana"},
+			"departmentNumber": {"D01"},
+			"memberOf":         groups,
+		}),
+		password: password,
+	}
+}
+
+func testLDAPConfig() config.LDAPConfig {
+	return config.LDAPConfig{
+		BindDN:       testServiceDN,
+		BindPassword: testServicePassword,
+		BaseDN:       "dc=example,dc=org",
+		UserFilter:   "(employeeID=%s)",
+		Attributes: config.LDAPAttributes{
+			UserID:       "sAMAccountName",
+			Name:         "displayName",
+			NIP:          "employeeID",
+			Jabatan:      "title",
+			DepartmentID: "departmentNumber",
+		},
+		DefaultRole: RoleContributor,
+		GroupRoles: map[string]string{
+			testSupervisorGroup: RoleSupervisor,
+			testReviewerGroup:   RoleReviewer,
+		},
+	}
+}
+
+func newTestLDAPAuthenticator(dir *fakeDirectory) *LDAPAuthenticator {
+	auth := NewLDAPAuthenticator(testLDAPConfig())
+	auth.Dial = func(config.LDAPConfig) (ldapConn, error) {
+		dir.bound = ""
+		return dir, nil
+	}
+	return auth
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	dir := &fakeDirectory{users: map[string]fakeUser{}}
+	dir.add("198001012000011001", "right-password")
+	auth := newTestLDAPAuthenticator(dir)
+
+	user, err := auth.Authenticate(context.Background(), "198001012000011001", "right-password")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	want := AuthData{
+		UserID:       "user198001012000011001",
+		Name:         "User 198001012000011001",
+		NIP:          "198001012000011001",
+		Jabatan:      "Pelaksana",
+		DepartmentID: "D01",
+		Role:         RoleContributor,
+	}
+	if *user != want {
+		t.Errorf("Authenticate = %+v, want %+v", *user, want)
+	}
+}
+
+func TestLDAPAuthenticateInvalidCredentials(t *testing.T) {
+	dir := &fakeDirectory{users: map[string]fakeUser{}}
+	dir.add("198001012000011001", "right-password")
+	auth := newTestLDAPAuthenticator(dir)
+
+	for name, creds := range map[string][2]string{
+		"wrong password": {"198001012000011001", "wrong-password"},
+		"empty password": {"198001012000011001", ""},
+		"missing user":   {"199912312000011999", "right-password"},
+		"filter escape":  {"*", "right-password"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			user, err := auth.Authenticate(context.Background(), creds[0], creds[1])
+			if !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("Authenticate = %+v, %v; want ErrInvalidCredentials", user, err)
+			}
+		})
+	}
+}
+
+func TestLDAPDeactivatedUser(t *testing.T) {
+	const (
+		active      = "198001012000011001"
+		deactivated = "198001012000011002"
+		directory   = "198001012000011003" // no row in users
+		broken      = "198001012000011004"
+	)
+	db := &fakeDB{query: func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		if query != "SELECT active FROM users WHERE nip = ?" {
+			return nil, nil, errors.New("unexpected query: " + query)
+		}
+		switch args[0].Value {
+		case active:
+			return []string{"active"}, [][]driver.Value{{true}}, nil
+		case deactivated:
+			return []string{"active"}, [][]driver.Value{{false}}, nil
+		case broken:
+			return nil, nil, errors.New("connection reset")
+		}
+		return []string{"active"}, nil, nil
+	}}
+	app := newTestApp(t, db)
+
+	selected, err := app.newAuthenticator(config.AuthConfig{Backend: "ldap", LDAP: testLDAPConfig()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := selected.(*LDAPAuthenticator)
+	dir := &fakeDirectory{users: map[string]fakeUser{}}
+	for _, nip := range []string{active, deactivated, directory, broken} {
+		dir.add(nip, "right-password")
+	}
+	auth.Dial = func(config.LDAPConfig) (ldapConn, error) {
+		dir.bound = ""
+		return dir, nil
+	}
+
+	for _, nip := range []string{active, directory} {
+		if _, err := auth.Authenticate(context.Background(), nip, "right-password"); err != nil {
+			t.Errorf("Authenticate(%s) = %v, want success", nip, err)
+		}
+	}
+	if _, err := auth.Authenticate(context.Background(), deactivated, "right-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate of a deactivated user = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := auth.Authenticate(context.Background(), broken, "right-password"); err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate with the users table unavailable = %v, want a server error", err)
+	}
+}
+
+func TestLDAPGroupRoles(t *testing.T) {
+	dir := &fakeDirectory{users: map[string]fakeUser{}}
+	dir.add("1001", "pw")
+	dir.add("1002", "pw", testReviewerGroup)
+	dir.add("1003", "pw", strings.ToUpper(testSupervisorGroup))
+	dir.add("1004", "pw", testReviewerGroup, testSupervisorGroup)
+	auth := newTestLDAPAuthenticator(dir)
+
+	for nip, want := range map[string]string{
+		"1001": RoleContributor, // no mapped group, default_role
+		"1002": RoleReviewer,
+		"1003": RoleSupervisor, // group DNs compare case-insensitively
+		"1004": RoleSupervisor, // the most privileged role wins
+	} {
+		user, err := auth.Authenticate(context.Background(), nip, "pw")
+		if err != nil {
+			t.Errorf("Authenticate(%s): %v", nip, err)
+			continue
+		}
+		if user.Role != want {
+			t.Errorf("Authenticate(%s).Role = %q, want %q", nip, user.Role, want)
+		}
+	}
+}
+
+func TestLDAPRoleAttribute(t *testing.T) {
+	dir := &fakeDirectory{users: map[string]fakeUser{}}
+	dir.add("1001", "pw", testReviewerGroup)
+	dir.users["uid=1001,ou=people,dc=example,dc=org"].entry.Attributes = append(
+		dir.users["uid=1001,ou=people,dc=example,dc=org"].entry.Attributes,
+		ldap.NewEntryAttribute("gofsRole", []string{RoleSupervisor}))
+	auth := newTestLDAPAuthenticator(dir)
+	auth.Config.Attributes.Role = "gofsRole"
+
+	user, err := auth.Authenticate(context.Background(), "1001", "pw")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.Role != RoleSupervisor {
+		t.Errorf("Role = %q, want the role attribute %q over group_roles", user.Role, RoleSupervisor)
+	}
+}
+
+func TestReloadSwitchesAuthenticator(t *testing.T) {
+	app := newTestApp(t, &fakeDB{})
+	if _, ok := app.currentAuthenticator().(*MySQLAuthenticator); !ok {
+		t.Fatalf("authenticator = %T, want *MySQLAuthenticator", app.currentAuthenticator())
+	}
+
+	changes, err := app.Reload(writeTestConfig(t, testConfig+`
+auth:
+  backend: ldap
+  ldap:
+    url: ldap://127.0.0.1:389
+    base_dn: dc=example,dc=org
+    user_filter: (employeeID=%s)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) == 0 {
+		t.Fatal("reload reported no changes")
+	}
+	if app.Config().Auth.Backend != "ldap" {
+		t.Errorf("auth.backend = %q after reload, want ldap", app.Config().Auth.Backend)
+	}
+	if _, ok := app.currentAuthenticator().(*LDAPAuthenticator); !ok {
+		t.Errorf("authenticator = %T after reload, want *LDAPAuthenticator", app.currentAuthenticator())
+	}
+}
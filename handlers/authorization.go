@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"watcher/logging"
+	"watcher/response"
+
+	"github.com/gorilla/mux"
+)
+
+// Roles used by the documentation workflow (see documentation_instruction.txt).
+const (
+	RoleContributor = "contributor"
+	RoleReviewer    = "reviewer"
+	RoleSupervisor  = "supervisor"
+)
+
+// GetAuthData returns the AuthData stored in the request context by AuthMiddleware.
+func GetAuthData(r *http.Request) (*AuthData, bool) {
+	authData, ok := r.Context().Value(AuthContextKey).(*AuthData)
+	return authData, ok && authData != nil
+}
+
+// isAPITokenRequest reports whether the request was authenticated with a bearer
+// API token rather than a session cookie.
+func isAPITokenRequest(r *http.Request) bool {
+	viaToken, _ := r.Context().Value(APITokenContextKey).(bool)
+	return viaToken
+}
+
+// currentAuthData returns the AuthData set by AuthMiddleware, falling back to the
+// session cookie when the middleware is not active (dev mode).
+func (app *App) currentAuthData(r *http.Request) (*AuthData, error) {
+	if authData, ok := GetAuthData(r); ok {
+		return authData, nil
+	}
+	authData, err := app.getSessionData(r)
+	if err == nil {
+		logging.SetUser(r.Context(), authData.NIP)
+	}
+	return authData, err
+}
+
+// hasRole reports whether the user's role is one of the given roles.
+func hasRole(authData *AuthData, roles []string) bool {
+	for _, role := range roles {
+		if strings.EqualFold(authData.Role, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// routeRoles looks up the roles required by the matched route in the permission
+// matrix from config.yaml. Routes without a name or entry require no role.
+func (app *App) routeRoles(r *http.Request) []string {
+	route := mux.CurrentRoute(r)
+	if route == nil || route.GetName() == "" {
+		return nil
+	}
+	return app.Config().Permissions[route.GetName()]
+}
+
+// AuthorizeMiddleware checks the authenticated user's role against the permission
+// matrix for the matched route. It must run after AuthMiddleware.
+func (app *App) AuthorizeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roles := app.routeRoles(r)
+		if len(roles) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		authData, ok := GetAuthData(r)
+		if !ok {
+			response.Error(w, r, response.CodeUnauthorized, "Unauthorized: no session")
+			return
+		}
+
+		if !hasRole(authData, roles) {
+			response.Error(w, r, response.CodeForbidden, fmt.Sprintf("Forbidden: requires role %s", strings.Join(roles, " or ")))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRoles wraps a single handler with a fixed role check, for routes whose
+// permissions should not be changed through config. Like the handlers it
+// falls back to the session cookie when AuthMiddleware is not active.
+func (app *App) RequireRoles(roles ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authData, err := app.currentAuthData(r)
+			if err != nil {
+				response.Error(w, r, response.CodeUnauthorized, err.Error())
+				return
+			}
+
+			if !hasRole(authData, roles) {
+				response.Error(w, r, response.CodeForbidden, fmt.Sprintf("Forbidden: requires role %s", strings.Join(roles, " or ")))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
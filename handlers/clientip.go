@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// trustedProxies parses proxy.trusted from config.yaml into prefixes.
+func (app *App) trustedProxies() []netip.Prefix {
+	return parsePrefixes(app.Config().Proxy.Trusted)
+}
+
+// parsePrefixes parses addresses and CIDR ranges from config.yaml. Single
+// addresses are treated as /32 or /128.
+func parsePrefixes(entries []string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		}
+	}
+	return prefixes
+}
+
+func isTrustedProxy(addr netip.Addr, trusted []netip.Prefix) bool {
+	return containsAddr(trusted, addr)
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIP parses an address as found in RemoteAddr or forwarding headers, with
+// or without port, brackets or quotes.
+func parseIP(value string) (netip.Addr, bool) {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// forwardedChain returns the client addresses listed by proxies, nearest proxy
+// last, from the Forwarded header (RFC 7239) or else X-Forwarded-For.
+func forwardedChain(r *http.Request) []string {
+	var chain []string
+	if values := r.Header.Values("Forwarded"); len(values) > 0 {
+		for _, value := range values {
+			for _, element := range strings.Split(value, ",") {
+				for _, pair := range strings.Split(element, ";") {
+					key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+					if ok && strings.EqualFold(key, "for") {
+						chain = append(chain, val)
+					}
+				}
+			}
+		}
+		return chain
+	}
+
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			chain = append(chain, hop)
+		}
+	}
+	return chain
+}
+
+// clientAddr returns the address of the client that sent the request. When the
+// direct peer is a trusted proxy, the forwarding headers are walked from the
+// nearest hop outwards and the first address that is not a trusted proxy wins.
+func (app *App) clientAddr(r *http.Request) (netip.Addr, bool) {
+	remote, ok := parseIP(r.RemoteAddr)
+	if !ok {
+		return netip.Addr{}, false
+	}
+
+	trusted := app.trustedProxies()
+	if !isTrustedProxy(remote, trusted) {
+		return remote, true
+	}
+
+	chain := forwardedChain(r)
+	client := remote
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, ok := parseIP(chain[i])
+		if !ok {
+			// obfuscated or unknown identifier, stop at the last known hop
+			break
+		}
+		client = addr
+		if !isTrustedProxy(addr, trusted) {
+			break
+		}
+	}
+	return client, true
+}
+
+// clientIP returns the client address as a string, falling back to RemoteAddr.
+func (app *App) clientIP(r *http.Request) string {
+	if addr, ok := app.clientAddr(r); ok {
+		return addr.String()
+	}
+	return r.RemoteAddr
+}
+
+// setClientIP fills the IP fields of AuthData from the request.
+func (app *App) setClientIP(user *AuthData, r *http.Request) {
+	addr, ok := app.clientAddr(r)
+	if !ok {
+		user.IP = r.RemoteAddr
+		return
+	}
+
+	user.IP = addr.String()
+	user.IPv4, user.IPv6 = "", ""
+	if addr.Is4() {
+		user.IPvX = "IPv4"
+		user.IPv4 = addr.String()
+	} else {
+		user.IPvX = "IPv6"
+		user.IPv6 = addr.String()
+	}
+}
+
+// sessionIPMatches reports whether a request comes from the address a session
+// is bound to, according to session.bind_ip in config.yaml.
+func (app *App) sessionIPMatches(authData *AuthData, r *http.Request) bool {
+	cfg := app.Config().Session
+	if cfg.BindIP == "none" {
+		return true
+	}
+
+	origin, ok := parseIP(authData.IP)
+	if !ok {
+		return false
+	}
+	current, ok := app.clientAddr(r)
+	if !ok {
+		return false
+	}
+
+	if cfg.BindIP == "ip" {
+		return origin == current
+	}
+
+	bits := cfg.BindIPv6Prefix
+	if origin.Is4() {
+		bits = cfg.BindIPv4Prefix
+	}
+	prefix, err := origin.Prefix(bits)
+	if err != nil {
+		return false
+	}
+	return prefix.Contains(current)
+}
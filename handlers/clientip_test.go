@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// newClientIPTestApp returns an App trusting the given proxies and binding
+// sessions as bindIP says.
+func newClientIPTestApp(t *testing.T, trusted []string, bindIP string) *App {
+	t.Helper()
+	app := newTestApp(t, &fakeDB{})
+	cfg := *app.Config()
+	cfg.Proxy.Trusted = trusted
+	cfg.Session.BindIP = bindIP
+	app.SetConfig(&cfg)
+	return app
+}
+
+func TestClientIP(t *testing.T) {
+	app := newClientIPTestApp(t, []string{"10.0.0.0/8", "2001:db8::1"}, "none")
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		xff       []string // one entry per header
+		want      string
+	}{
+		{"no proxy", "203.0.113.5:1234", "", nil, "203.0.113.5"},
+		{"untrusted remote sending X-Forwarded-For", "203.0.113.5:1234", "", []string{"198.51.100.7"}, "203.0.113.5"},
+		{"untrusted remote sending Forwarded", "203.0.113.5:1234", "for=198.51.100.7", nil, "203.0.113.5"},
+		{"trusted proxy", "10.0.0.1:443", "", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"spoofed leftmost entry", "10.0.0.1:443", "", []string{"1.2.3.4, 198.51.100.7"}, "198.51.100.7"},
+		{"spoofed entry in a second header", "10.0.0.1:443", "", []string{"1.2.3.4", "198.51.100.7"}, "198.51.100.7"},
+		{"chain of trusted proxies", "10.0.0.1:443", "", []string{"1.2.3.4, 198.51.100.7, 10.0.0.2"}, "198.51.100.7"},
+		{"only trusted hops", "10.0.0.1:443", "", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"trusted proxy without header", "10.0.0.1:443", "", nil, "10.0.0.1"},
+		{"Forwarded", "10.0.0.1:443", "for=192.0.2.43, for=198.51.100.17;proto=https", nil, "198.51.100.17"},
+		{"Forwarded before X-Forwarded-For", "10.0.0.1:443", "for=198.51.100.17", []string{"192.0.2.43"}, "198.51.100.17"},
+		{"Forwarded quoted IPv6 with port", "10.0.0.1:443", `for="[2001:db8:cafe::17]:4711"`, nil, "2001:db8:cafe::17"},
+		{"Forwarded quoted IPv4 with port", "10.0.0.1:443", `For="198.51.100.17:8080"`, nil, "198.51.100.17"},
+		{"obfuscated hop stops the walk", "10.0.0.1:443", "for=198.51.100.17, for=_hidden", nil, "10.0.0.1"},
+		{"unknown hop stops the walk", "10.0.0.1:443", "for=198.51.100.17, for=unknown", nil, "10.0.0.1"},
+		{"IPv6 trusted proxy", "[2001:db8::1]:443", "", []string{"203.0.113.9"}, "203.0.113.9"},
+		{"IPv6 untrusted remote", "[2001:db8::2]:443", "", []string{"203.0.113.9"}, "2001:db8::2"},
+		{"IPv4-mapped trusted proxy", "[::ffff:10.0.0.1]:443", "", []string{"203.0.113.9"}, "203.0.113.9"},
+		{"IPv4-mapped client", "10.0.0.1:443", "", []string{"::ffff:203.0.113.9"}, "203.0.113.9"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			r.Header.Set("Forwarded", tt.forwarded)
+		}
+		for _, value := range tt.xff {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		if got := app.clientIP(r); got != tt.want {
+			t.Errorf("%s: clientIP = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSetClientIP(t *testing.T) {
+	app := newClientIPTestApp(t, nil, "none")
+	tests := []struct {
+		remote             string
+		wantIP, wantIPvX   string
+		wantIPv4, wantIPv6 string
+	}{
+		{"203.0.113.5:1234", "203.0.113.5", "IPv4", "203.0.113.5", ""},
+		{"[2001:db8::5]:1234", "2001:db8::5", "IPv6", "", "2001:db8::5"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		var user AuthData
+		app.setClientIP(&user, r)
+		if user.IP != tt.wantIP || user.IPvX != tt.wantIPvX || user.IPv4 != tt.wantIPv4 || user.IPv6 != tt.wantIPv6 {
+			t.Errorf("setClientIP(%s) = %+v", tt.remote, user)
+		}
+	}
+}
+
+func TestSessionIPMatches(t *testing.T) {
+	tests := []struct {
+		bindIP  string
+		origin  string
+		current string
+		want    bool
+	}{
+		{"none", "203.0.113.5", "198.51.100.7:1", true},
+		{"ip", "203.0.113.5", "203.0.113.5:1", true},
+		{"ip", "203.0.113.5", "203.0.113.6:1", false},
+		{"subnet", "203.0.113.5", "203.0.113.250:1", true},
+		{"subnet", "203.0.113.5", "203.0.114.5:1", false},
+		{"subnet", "2001:db8:0:1::5", "[2001:db8:0:1:ffff::1]:1", true},
+		{"subnet", "2001:db8:0:1::5", "[2001:db8:0:2::5]:1", false},
+		{"subnet", "203.0.113.5", "[2001:db8::5]:1", false},
+		{"subnet", "not an address", "203.0.113.5:1", false},
+	}
+	for _, tt := range tests {
+		// bind_ipv4_prefix 24 and bind_ipv6_prefix 64 are the defaults
+		app := newClientIPTestApp(t, nil, tt.bindIP)
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.current
+		if got := app.sessionIPMatches(&AuthData{IP: tt.origin}, r); got != tt.want {
+			t.Errorf("bind_ip %s: session from %s used from %s = %v, want %v", tt.bindIP, tt.origin, tt.current, got, tt.want)
+		}
+	}
+}
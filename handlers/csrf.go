@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"watcher/response"
+	"watcher/store"
+
+	"github.com/gorilla/mux"
+)
+
+// CSRFHeader carries the session's CSRF token on state-changing requests.
+const CSRFHeader = "X-CSRF-Token"
+
+// csrfExemptRoutes create sessions rather than act on one, so they cannot carry
+// a token yet.
+var csrfExemptRoutes = map[string]bool{
+	"auth.login":     true,
+	"auth.login.2fa": true,
+}
+
+// generateCSRFToken returns a random token for a new session.
+func generateCSRFToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// sessionCSRFToken returns the CSRF token stored with a session (synchronizer
+// token pattern). ok is false when the session does not exist.
+func (app *App) sessionCSRFToken(ctx context.Context, sessionToken string) (csrf string, ok bool, err error) {
+	exists, err := app.Sessions.Exists(ctx, sessionKey(sessionToken))
+	if err != nil {
+		return "", false, fmt.Errorf("failed to check session: %w", err)
+	}
+	if !exists {
+		return "", false, nil
+	}
+
+	csrf, err = app.Sessions.HGet(ctx, sessionMetaKey(sessionToken), "csrf")
+	if err == store.ErrNotFound {
+		return "", true, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get CSRF token: %w", err)
+	}
+	return csrf, true, nil
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// CSRFMiddleware requires state-changing requests that ride on a live
+// session_token cookie to echo the session's CSRF token in the X-CSRF-Token
+// header. Requests using a bearer API token carry no ambient credentials and
+// are not checked.
+func (app *App) CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isSafeMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, ok := bearerToken(r); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if route := mux.CurrentRoute(r); route != nil && csrfExemptRoutes[route.GetName()] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cookie, err := r.Cookie("session_token")
+		if err != nil {
+			// no ambient credentials to forge with
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		expected, live, err := app.sessionCSRFToken(r.Context(), cookie.Value)
+		if err != nil {
+			response.Internal(w, r, "Failed to check CSRF token", err)
+			return
+		}
+		if !live {
+			// stale cookie, the handler will reject it if it needs a session
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		got := r.Header.Get(CSRFHeader)
+		if expected == "" || got == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(got)) != 1 {
+			response.Error(w, r, response.CodeCSRF, "Forbidden: missing or invalid CSRF token")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
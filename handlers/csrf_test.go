@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	db := &fakeDB{query: func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		return []string{"user_id", "role", "name", "nip", "jabatan", "department_id", "password"}, nil, nil // no such user
+	}}
+	app := newTestApp(t, db)
+	srv := httptest.NewServer(app.Handler())
+	defer srv.Close()
+
+	cookie, csrf := newTestSession(t, app, testSupervisor())
+
+	// state-changing routes refuse a live session cookie without its token
+	for _, path := range []string{"/outbox/update", "/docvault/update", "/docs/generate"} {
+		for _, token := range []string{"", "wrong-token"} {
+			status, env := doJSON(t, http.DefaultClient, "POST", srv.URL+path, nil, sessionHeader(cookie, token))
+			if status != http.StatusForbidden || env.Code != "csrf_invalid" {
+				t.Errorf("POST %s with CSRF token %q = %d %q, want 403 csrf_invalid", path, token, status, env.Code)
+			}
+		}
+	}
+
+	// the session's token passes, here up to the missing documentations database
+	status, env := doJSON(t, http.DefaultClient, "POST", srv.URL+"/docs/generate", nil, sessionHeader(cookie, csrf))
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("POST /docs/generate with the CSRF token = %d %q, want 503", status, env.Code)
+	}
+
+	// logins cannot carry a token yet, even with an old session cookie around
+	status, env = doJSON(t, http.DefaultClient, "POST", srv.URL+"/auth/login",
+		LoginRequest{NIP: testTargetNIP, Password: "guess"}, sessionHeader(cookie, ""))
+	if status != http.StatusUnauthorized || env.Code != "invalid_credentials" {
+		t.Errorf("POST /auth/login without a CSRF token = %d %q, want 401 invalid_credentials", status, env.Code)
+	}
+	status, env = doJSON(t, http.DefaultClient, "POST", srv.URL+"/auth/login/2fa",
+		TwoFactorRequest{Challenge: "unknown", Code: "123456"}, sessionHeader(cookie, ""))
+	if status != http.StatusUnauthorized || env.Code != "unauthorized" {
+		t.Errorf("POST /auth/login/2fa without a CSRF token = %d %q, want 401 unauthorized", status, env.Code)
+	}
+
+	// bearer tokens carry no ambient credentials and skip the check
+	status, env = doJSON(t, http.DefaultClient, "POST", srv.URL+"/auth/tokens",
+		CreateAPITokenRequest{Name: "ci", Scopes: []string{"docs.generate"}}, sessionHeader(cookie, csrf))
+	if status != http.StatusCreated {
+		t.Fatalf("create token = %d %q, want 201", status, env.Code)
+	}
+	var created struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(env.Data, &created); err != nil || created.Token == "" {
+		t.Fatalf("token data %s has no token", env.Data)
+	}
+	header := sessionHeader(cookie, "")
+	header.Set("Authorization", "Bearer "+created.Token)
+	status, env = doJSON(t, http.DefaultClient, "POST", srv.URL+"/docs/generate", nil, header)
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("POST /docs/generate with a bearer token = %d %q, want 503", status, env.Code)
+	}
+}
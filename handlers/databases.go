@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"net/http"
+	"watcher/response"
+
+	"github.com/gorilla/mux"
+)
+
+// RequireDatabase answers 503 while an optional database is not connected,
+// so an outage only takes down the routes that depend on it.
+func (app *App) RequireDatabase(name string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if app.Database(name) == nil {
+				w.Header().Set("Retry-After", "30")
+				response.Error(w, r, response.CodeUnavailable, "Service Unavailable: database '"+name+"' is not connected")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
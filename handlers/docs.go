@@ -1,14 +1,13 @@
 package handlers
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
-	"watcher/config"
+	"watcher/response"
 )
 
 type FileInfo struct {
@@ -17,34 +16,15 @@ type FileInfo struct {
 	LastUpdated time.Time `json:"last_updated"`
 }
 
-func DocsGenerateHandler(w http.ResponseWriter, r *http.Request) {
-	db, ok := config.DB["documentations"]
-	if !ok {
-		http.Error(w, "Database connection 'documentations' not found", http.StatusInternalServerError)
-		return
-	}
-
-	// Create table if not exists
-	createTableSQL := `
-	CREATE TABLE IF NOT EXISTS raw_list (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		file_name VARCHAR(255) NOT NULL,
-		file_path VARCHAR(255) NOT NULL,
-		last_updated TIMESTAMP NOT NULL,
-		UNIQUE KEY (file_path)
-	);`
-
-	if _, err := db.Exec(createTableSQL); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create table: %s", err), http.StatusInternalServerError)
-		return
-	}
+func (app *App) DocsGenerateHandler(w http.ResponseWriter, r *http.Request) {
+	db := app.Database("documentations") // connected, the route goes through RequireDatabase
 
-	dirPath := "documentations/raw"
+	dirPath := app.Config().Paths.DocumentationsRaw
 
 	// Check if the directory exists, create it if it doesn't
 	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
 		if err := os.MkdirAll(dirPath, 0755); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create directory: %s", err), http.StatusInternalServerError)
+			response.Internal(w, r, "Failed to create directory", err)
 			return
 		}
 	}
@@ -65,19 +45,18 @@ func DocsGenerateHandler(w http.ResponseWriter, r *http.Request) {
 	})
 
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to read directory: %s", err), http.StatusInternalServerError)
+		response.Internal(w, r, "Failed to read directory", err)
 		return
 	}
 
 	if len(files) == 0 {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"message": "No files found in directory to process"})
+		response.OK(w, r, "No files found in directory to process", nil)
 		return
 	}
 
 	tx, err := db.Begin()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to begin transaction: %s", err), http.StatusInternalServerError)
+		response.Internal(w, r, "Failed to begin transaction", err)
 		return
 	}
 
@@ -88,7 +67,7 @@ func DocsGenerateHandler(w http.ResponseWriter, r *http.Request) {
 	`)
 	if err != nil {
 		tx.Rollback()
-		http.Error(w, fmt.Sprintf("Failed to prepare statement: %s", err), http.StatusInternalServerError)
+		response.Internal(w, r, "Failed to prepare statement", err)
 		return
 	}
 	defer stmt.Close()
@@ -97,16 +76,15 @@ func DocsGenerateHandler(w http.ResponseWriter, r *http.Request) {
 		_, err := stmt.Exec(file.FileName, strings.Replace(file.FilePath, "\\", "/", -1), file.LastUpdated)
 		if err != nil {
 			tx.Rollback()
-			http.Error(w, fmt.Sprintf("Failed to execute statement for file %s: %s", file.FileName, err), http.StatusInternalServerError)
+			response.Internal(w, r, fmt.Sprintf("Failed to execute statement for file %s", file.FileName), err)
 			return
 		}
 	}
 
 	if err := tx.Commit(); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to commit transaction: %s", err), http.StatusInternalServerError)
+		response.Internal(w, r, "Failed to commit transaction", err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Successfully inserted/updated file list in the database"})
+	response.OK(w, r, "Successfully inserted/updated file list in the database", map[string]int{"files": len(files)})
 }
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,21 +8,23 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"watcher/logging"
+	"watcher/response"
 )
 
-func CreateDocHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Printf("create new doc route! \n")
+func (app *App) CreateDocHandler(w http.ResponseWriter, r *http.Request) {
+	logging.From(r.Context()).Debug("create new doc")
 
 	// Parse the multipart form
 	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10 MB
-		http.Error(w, "Failed to parse multipart form", http.StatusBadRequest)
+		response.Error(w, r, response.CodeInvalidRequest, "Failed to parse multipart form")
 		return
 	}
 
 	// Get the file from the form
 	file, handler, err := r.FormFile("file")
 	if err != nil {
-		http.Error(w, "Failed to get file from form", http.StatusBadRequest)
+		response.Error(w, r, response.CodeInvalidRequest, "Failed to get file from form")
 		return
 	}
 	defer file.Close()
@@ -33,29 +34,29 @@ func CreateDocHandler(w http.ResponseWriter, r *http.Request) {
 	title := r.FormValue("title")
 
 	if category == "" || title == "" {
-		http.Error(w, "Category and title are required", http.StatusBadRequest)
+		response.Error(w, r, response.CodeInvalidRequest, "Category and title are required")
 		return
 	}
 
 	// Sanitize title for directory name
 	reg, err := regexp.Compile("[^a-zA-Z0-9]+")
 	if err != nil {
-		http.Error(w, "Failed to compile regex", http.StatusInternalServerError)
+		response.Internal(w, r, "Failed to compile regex", err)
 		return
 	}
 	sanitizedTitle := strings.ToLower(reg.ReplaceAllString(title, "-"))
 
 	// Create directory structure
-	docPath := filepath.Join("documentations", category, sanitizedTitle)
+	docPath := filepath.Join(app.Config().Paths.Documentations, category, sanitizedTitle)
 	if err := os.MkdirAll(docPath, 0755); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create document directory: %s", err), http.StatusInternalServerError)
+		response.Internal(w, r, "Failed to create document directory", err)
 		return
 	}
 
 	// Create subdirectories
 	for _, dir := range []string{"media", "refs", "objects"} {
 		if err := os.MkdirAll(filepath.Join(docPath, dir), 0755); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create subdirectory %s: %s", dir, err), http.StatusInternalServerError)
+			response.Internal(w, r, fmt.Sprintf("Failed to create subdirectory %s", dir), err)
 			return
 		}
 	}
@@ -64,21 +65,19 @@ func CreateDocHandler(w http.ResponseWriter, r *http.Request) {
 	mainMdPath := filepath.Join(docPath, "main.md")
 	dst, err := os.Create(mainMdPath)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create main.md: %s", err), http.StatusInternalServerError)
+		response.Internal(w, r, "Failed to create main.md", err)
 		return
 	}
 	defer dst.Close()
 
 	// Copy file content
 	if _, err := io.Copy(dst, file); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to write to main.md: %s", err), http.StatusInternalServerError)
+		response.Internal(w, r, "Failed to write to main.md", err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Document created successfully",
-		"path":    docPath,
-		"file":    handler.Filename,
+	response.Created(w, r, "Document created successfully", map[string]string{
+		"path": docPath,
+		"file": handler.Filename,
 	})
 }
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"watcher/response"
 )
 
 type DocItem struct {
@@ -15,12 +16,12 @@ type DocItem struct {
 
 // UpdateDocVaultHandler processes files in src/scanned, categorizes them by owner,
 // writes the data to data.json, and returns the full categorized data.
-func UpdateDocVaultHandler(w http.ResponseWriter, r *http.Request) {
-	scannedDir := "src/scanned"
+func (app *App) UpdateDocVaultHandler(w http.ResponseWriter, r *http.Request) {
+	scannedDir := app.Config().Paths.Scanned
 
 	files, err := os.ReadDir(scannedDir)
 	if err != nil {
-		http.Error(w, "Failed to read scanned directory", http.StatusInternalServerError)
+		response.Internal(w, r, "Failed to read scanned directory", err)
 		return
 	}
 
@@ -44,26 +45,23 @@ func UpdateDocVaultHandler(w http.ResponseWriter, r *http.Request) {
 	// Always write the full data to data.json
 	jsonData, err := json.MarshalIndent(docsByOwner, "", "  ")
 	if err != nil {
-		http.Error(w, "Failed to marshal data to JSON", http.StatusInternalServerError)
+		response.Internal(w, r, "Failed to marshal data to JSON", err)
 		return
 	}
 
-	jsonPath := filepath.Join("src", "libs", "scanned.json")
+	jsonPath := filepath.Join(app.Config().Paths.Libs, "scanned.json")
 	err = os.WriteFile(jsonPath, jsonData, 0644)
 	if err != nil {
-		http.Error(w, "Failed to write JSON file", http.StatusInternalServerError)
+		response.Internal(w, r, "Failed to write JSON file", err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	response := map[string]any{"status": true, "data": docsByOwner} // Always return full data
-	json.NewEncoder(w).Encode(response)
+	response.OK(w, r, "", docsByOwner) // Always return full data
 }
 
 // GetDocVaultHandler reads data from data.json and filters it based on the owner query parameter.
-func GetDocVaultHandler(w http.ResponseWriter, r *http.Request) {
-	jsonPath := filepath.Join("src", "libs", "scanned.json")
+func (app *App) GetDocVaultHandler(w http.ResponseWriter, r *http.Request) {
+	jsonPath := filepath.Join(app.Config().Paths.Libs, "scanned.json")
 
 	// Get owner from query parameter
 	// filterOwner := r.URL.Query().Get("owner")
@@ -72,14 +70,14 @@ func GetDocVaultHandler(w http.ResponseWriter, r *http.Request) {
 	// Read the data.json file
 	jsonData, err := os.ReadFile(jsonPath)
 	if err != nil {
-		http.Error(w, "Failed to read scanned.json", http.StatusInternalServerError)
+		response.Internal(w, r, "Failed to read scanned.json", err)
 		return
 	}
 
 	var docsByOwner map[string][]DocItem
 	err = json.Unmarshal(jsonData, &docsByOwner)
 	if err != nil {
-		http.Error(w, "Failed to unmarshal scanned.json", http.StatusInternalServerError)
+		response.Internal(w, r, "Failed to unmarshal scanned.json", err)
 		return
 	}
 
@@ -96,8 +94,5 @@ func GetDocVaultHandler(w http.ResponseWriter, r *http.Request) {
 		responseData = docsByOwner
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	response := map[string]any{"status": true, "data": responseData}
-	json.NewEncoder(w).Encode(response)
+	response.OK(w, r, "", responseData)
 }
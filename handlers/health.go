@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+	"watcher/logging"
+	"watcher/response"
+)
+
+// readyTimeout bounds each readiness check, so a hung dependency fails the
+// probe instead of stalling it.
+const readyTimeout = 2 * time.Second
+
+// ghostscriptCheckInterval is how long the result of running Ghostscript is
+// reused, so frequent probes do not start a process each.
+const ghostscriptCheckInterval = 10 * time.Second
+
+// ComponentStatus is the result of one readiness check. Components that are
+// not Required (optional databases) are reported but do not fail /readyz. Why
+// a component is down is logged, not returned, since /readyz is public.
+type ComponentStatus struct {
+	Status     string  `json:"status"` // "up" or "down"
+	Required   bool    `json:"required"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+type readyCheck struct {
+	name     string
+	required bool
+	check    func(ctx context.Context) error
+}
+
+// HealthzHandler reports that the process is running and serving requests.
+// It checks nothing else, so a supervisor only restarts a hung process.
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	response.OK(w, r, "alive", nil)
+}
+
+// ReadyzHandler checks every dependency in parallel and answers 200 when all
+// required ones are up, 503 otherwise, with the status and timing of each.
+func (app *App) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	checks := app.readyChecks()
+	results := make(map[string]ComponentStatus, len(checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := c.check(ctx)
+			result := ComponentStatus{
+				Status:     "up",
+				Required:   c.required,
+				DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = "down"
+				logging.From(r.Context()).Warn("readiness check failed", "component", c.name, "required", c.required, "error", err)
+			}
+			mu.Lock()
+			results[c.name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	ready := true
+	var down []string
+	for name, result := range results {
+		if result.Status != "up" && result.Required {
+			ready = false
+			down = append(down, name)
+		}
+	}
+	sort.Strings(down)
+
+	w.Header().Set("Cache-Control", "no-store")
+	data := map[string]any{"components": results}
+	if !ready {
+		w.Header().Set("Retry-After", "30")
+		response.ErrorData(w, r, response.CodeUnavailable, fmt.Sprintf("not ready: %v down", down), data)
+		return
+	}
+	response.OK(w, r, "ready", data)
+}
+
+// readyChecks lists the dependencies of the current configuration: the
+// session store, every mysql entry, Ghostscript and the writable directories.
+func (app *App) readyChecks() []readyCheck {
+	cfg := app.Config()
+
+	sessionsName := "redis"
+	if cfg.Session.Store != "redis" {
+		sessionsName = "sessions"
+	}
+	checks := []readyCheck{
+		{sessionsName, true, app.Sessions.Ping},
+		{"ghostscript", true, func(ctx context.Context) error {
+			return app.ghostscript.do(ctx, ghostscriptCheckInterval, func(ctx context.Context) error {
+				return checkGhostscript(ctx, cfg.Server.Ghostscript)
+			})
+		}},
+		{"paths.libs", true, func(ctx context.Context) error {
+			return checkWritable(cfg.Paths.Libs)
+		}},
+		{"paths.pdf_compression", true, func(ctx context.Context) error {
+			return checkWritable(cfg.Paths.PDFCompression)
+		}},
+	}
+
+	for name, dbCfg := range cfg.MySQL {
+		checks = append(checks, readyCheck{"mysql." + name, !dbCfg.Optional, func(ctx context.Context) error {
+			db := app.Database(name)
+			if db == nil {
+				return fmt.Errorf("not connected")
+			}
+			return db.PingContext(ctx)
+		}})
+	}
+	return checks
+}
+
+// cachedCheck remembers the result of a readiness check that is too costly
+// to run on every probe.
+type cachedCheck struct {
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+// do returns the last result of check if it is younger than interval, and
+// runs check otherwise. A check cut short by ctx is not remembered.
+func (c *cachedCheck) do(ctx context.Context, interval time.Duration, check func(context.Context) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.checked.IsZero() && time.Since(c.checked) < interval {
+		return c.err
+	}
+	err := check(ctx)
+	if ctx.Err() == nil {
+		c.checked, c.err = time.Now(), err
+	}
+	return err
+}
+
+// checkGhostscript runs the configured binary with --version.
+func checkGhostscript(ctx context.Context, gsPath string) error {
+	output, err := exec.CommandContext(ctx, gsPath, "--version").CombinedOutput()
+	if err != nil {
+		if len(output) > 0 {
+			return fmt.Errorf("%v: %s", err, output)
+		}
+		return err
+	}
+	return nil
+}
+
+// checkWritable creates and removes a file in dir.
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
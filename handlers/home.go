@@ -1,11 +1,11 @@
 package handlers
 
 import (
-	"fmt"
 	"net/http"
+	"watcher/response"
 )
 
 // HomeHandler handles requests to the root URL.
 func HomeHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "Hello from the handlers package!")
+	response.OK(w, r, "Hello from the handlers package!", nil)
 }
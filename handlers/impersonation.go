@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"watcher/logging"
+	"watcher/response"
+
+	"github.com/gorilla/mux"
+)
+
+// impersonationLifetime caps how long an impersonation session lasts.
+const impersonationLifetime = time.Hour
+
+// impersonationAllowedRoutes are the only state-changing routes an
+// impersonation session may call.
+var impersonationAllowedRoutes = map[string]bool{
+	"auth.impersonate.stop": true,
+	"auth.logout":           true,
+}
+
+// ImpersonationRequest is the optional payload of POST /auth/impersonate/{nip}.
+type ImpersonationRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ImpersonationAudit is a row of the impersonation_audit table.
+type ImpersonationAudit struct {
+	ID            int64     `json:"id"`
+	SupervisorNIP string    `json:"supervisor_nip"`
+	TargetNIP     string    `json:"target_nip"`
+	Action        string    `json:"action"` // start, stop or blocked
+	Detail        string    `json:"detail"`
+	IP            string    `json:"ip"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// auditImpersonation records an impersonation event. Failures are logged, not
+// returned, so an audit outage is visible without locking supervisors out.
+func (app *App) auditImpersonation(ctx context.Context, supervisorNIP, targetNIP, action, detail, ip string) {
+	logger := logging.From(ctx).With("supervisor_nip", supervisorNIP, "target_nip", targetNIP)
+	logger.Info("impersonation "+action, "detail", detail, "ip", ip)
+
+	_, err := app.Database("doctracer").ExecContext(ctx, `
+		INSERT INTO impersonation_audit (supervisor_nip, target_nip, action, detail, ip)
+		VALUES (?, ?, ?, ?, ?)
+	`, supervisorNIP, targetNIP, action, detail, ip)
+	if err != nil {
+		logger.Error("failed to write impersonation audit", "error", err)
+	}
+}
+
+// impersonationAllows reports whether a request may proceed. Impersonation
+// sessions are read-only apart from stopping the impersonation or logging out.
+func impersonationAllows(authData *AuthData, r *http.Request) bool {
+	if authData.ImpersonatedBy == nil || isSafeMethod(r.Method) {
+		return true
+	}
+	route := mux.CurrentRoute(r)
+	return route != nil && impersonationAllowedRoutes[route.GetName()]
+}
+
+// StartImpersonationHandler lets a supervisor open a derived session as another
+// user. The new session carries both identities, remembers the supervisor's
+// own session so StopImpersonationHandler can switch back, and is indexed under
+// the supervisor, so revoking the supervisor's access ends it.
+func (app *App) StartImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	supervisor, err := app.currentAuthData(r)
+	if err != nil {
+		response.Error(w, r, response.CodeUnauthorized, err.Error())
+		return
+	}
+	if supervisor.ImpersonatedBy != nil {
+		response.Error(w, r, response.CodeConflict, "Already impersonating, stop first")
+		return
+	}
+
+	original, err := r.Cookie("session_token")
+	if err != nil {
+		response.Error(w, r, response.CodeInvalidRequest, "Impersonation requires a session cookie")
+		return
+	}
+
+	var req ImpersonationRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			response.Error(w, r, response.CodeInvalidRequest, "Invalid request payload")
+			return
+		}
+	}
+
+	nip := mux.Vars(r)["nip"]
+	if nip == supervisor.NIP {
+		response.Error(w, r, response.CodeInvalidRequest, "Cannot impersonate yourself")
+		return
+	}
+
+	var target AuthData
+	row := app.Database("doctracer").QueryRowContext(r.Context(),
+		"SELECT user_id, role, name, nip, jabatan, department_id FROM users WHERE nip = ? AND active = TRUE", nip)
+	err = row.Scan(&target.UserID, &target.Role, &target.Name, &target.NIP, &target.Jabatan, &target.DepartmentID)
+	if err == sql.ErrNoRows {
+		response.Error(w, r, response.CodeNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		response.Internal(w, r, "Database error", err)
+		return
+	}
+	if hasRole(&target, []string{RoleSupervisor}) {
+		response.Error(w, r, response.CodeForbidden, "Forbidden: supervisors cannot be impersonated")
+		return
+	}
+
+	realUser := *supervisor
+	target.ImpersonatedBy = &realUser
+
+	_, csrf, err := app.createSession(w, r, &target, impersonationLifetime, map[string]string{
+		"original_session": original.Value,
+		"impersonator":     supervisor.NIP,
+	})
+	if err != nil {
+		response.Internal(w, r, "Failed to create session", err)
+		return
+	}
+
+	app.auditImpersonation(r.Context(), supervisor.NIP, target.NIP, "start", req.Reason, app.clientIP(r))
+
+	response.OK(w, r, fmt.Sprintf("Impersonating %s for at most %s", target.Name, impersonationLifetime), map[string]any{
+		"user":       target,
+		"csrf_token": csrf,
+	})
+}
+
+// StopImpersonationHandler ends an impersonation session and puts the
+// supervisor's own session back in the cookie, if it is still alive.
+func (app *App) StopImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	authData, err := app.currentAuthData(r)
+	if err != nil {
+		response.Error(w, r, response.CodeUnauthorized, err.Error())
+		return
+	}
+	if authData.ImpersonatedBy == nil {
+		response.Error(w, r, response.CodeInvalidRequest, "Not impersonating")
+		return
+	}
+
+	ctx := r.Context()
+	cookie, err := r.Cookie("session_token")
+	if err != nil {
+		response.Error(w, r, response.CodeInvalidRequest, "Impersonation requires a session cookie")
+		return
+	}
+	original, _ := app.Sessions.HGet(ctx, sessionMetaKey(cookie.Value), "original_session")
+
+	if err := app.deleteSession(ctx, cookie.Value, authData); err != nil {
+		response.Internal(w, r, "Failed to delete session", err)
+		return
+	}
+	app.auditImpersonation(ctx, authData.ImpersonatedBy.NIP, authData.NIP, "stop", "", app.clientIP(r))
+
+	restored := false
+	if original != "" {
+		if ttl, err := app.Sessions.TTL(ctx, sessionKey(original)); err == nil && ttl > 0 {
+			setSessionCookie(w, original, time.Now().Add(ttl))
+			restored = true
+		}
+	}
+	if !restored {
+		clearSessionCookie(w)
+	}
+
+	response.OK(w, r, "Impersonation stopped", map[string]any{"session_restored": restored})
+}
+
+// ListImpersonationAuditHandler returns the most recent impersonation events,
+// optionally filtered by ?nip= (supervisor or target) and ?limit=.
+func (app *App) ListImpersonationAuditHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if value, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && value > 0 && value <= 1000 {
+		limit = value
+	}
+
+	query := "SELECT id, supervisor_nip, target_nip, action, detail, ip, created_at FROM impersonation_audit"
+	args := []any{}
+	if nip := r.URL.Query().Get("nip"); nip != "" {
+		query += " WHERE supervisor_nip = ? OR target_nip = ?"
+		args = append(args, nip, nip)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := app.Database("doctracer").QueryContext(r.Context(), query, args...)
+	if err != nil {
+		response.Internal(w, r, "Database error", err)
+		return
+	}
+	defer rows.Close()
+
+	entries := make([]ImpersonationAudit, 0)
+	for rows.Next() {
+		var entry ImpersonationAudit
+		if err := rows.Scan(&entry.ID, &entry.SupervisorNIP, &entry.TargetNIP, &entry.Action, &entry.Detail, &entry.IP, &entry.CreatedAt); err != nil {
+			response.Internal(w, r, "Database error", err)
+			return
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		response.Internal(w, r, "Database error", err)
+		return
+	}
+
+	response.OK(w, r, "", entries)
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	testSupervisorNIP = "197001012000011001"
+	testTargetNIP     = "198001012000011002"
+)
+
+// impersonationDB answers the impersonation target lookup with a user whose
+// role is targetRole.
+func impersonationDB(targetRole string) *fakeDB {
+	return &fakeDB{query: func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		if strings.Contains(query, "FROM users WHERE nip = ?") {
+			columns := []string{"user_id", "role", "name", "nip", "jabatan", "department_id"}
+			if args[0].Value != testTargetNIP {
+				return columns, nil, nil
+			}
+			return columns, [][]driver.Value{{"u2", targetRole, "Target", testTargetNIP, "Pelaksana", "D01"}}, nil
+		}
+		return nil, nil, errors.New("unexpected query: " + query)
+	}}
+}
+
+func testSupervisor() *AuthData {
+	return &AuthData{UserID: "u1", Name: "Supervisor", Role: RoleSupervisor, NIP: testSupervisorNIP, DepartmentID: "D01"}
+}
+
+func sessionHeader(cookie *http.Cookie, csrf string) http.Header {
+	header := http.Header{"Cookie": {cookie.String()}}
+	if csrf != "" {
+		header.Set(CSRFHeader, csrf)
+	}
+	return header
+}
+
+// startImpersonation opens an impersonation of testTargetNIP through the API
+// and returns the response status and the new session cookie, if any.
+func startImpersonation(t *testing.T, app *App, srv *httptest.Server) (int, *http.Cookie) {
+	t.Helper()
+	cookie, csrf := newTestSession(t, app, testSupervisor())
+	req, err := http.NewRequest("POST", srv.URL+"/auth/impersonate/"+testTargetNIP, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header = sessionHeader(cookie, csrf)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	for _, c := range res.Cookies() {
+		if c.Name == "session_token" {
+			return res.StatusCode, c
+		}
+	}
+	return res.StatusCode, nil
+}
+
+func TestImpersonationEndsWithSupervisorAccess(t *testing.T) {
+	app := newTestApp(t, impersonationDB(RoleReviewer))
+	srv := httptest.NewServer(app.Handler())
+	defer srv.Close()
+
+	status, impersonation := startImpersonation(t, app, srv)
+	if status != http.StatusOK || impersonation == nil {
+		t.Fatalf("impersonate = %d, want 200 with a session cookie", status)
+	}
+
+	status, env := doJSON(t, http.DefaultClient, "GET", srv.URL+"/auth/session", nil, sessionHeader(impersonation, ""))
+	if status != http.StatusOK || !strings.Contains(string(env.Data), testTargetNIP) {
+		t.Fatalf("session while impersonating = %d %s, want 200 as %s", status, env.Data, testTargetNIP)
+	}
+
+	ctx := context.Background()
+	if sessions, err := app.listSessions(ctx, testTargetNIP, ""); err != nil || len(sessions) != 0 {
+		t.Errorf("target's sessions = %v, %v; want the impersonation listed only under the supervisor", sessions, err)
+	}
+
+	// what deactivating or demoting the supervisor does
+	app.revokeUserAccess(ctx, testSupervisorNIP)
+
+	status, env = doJSON(t, http.DefaultClient, "GET", srv.URL+"/auth/session", nil, sessionHeader(impersonation, ""))
+	if status != http.StatusUnauthorized {
+		t.Errorf("session after revoking the supervisor = %d %q, want 401", status, env.Code)
+	}
+}
+
+func TestImpersonationOfSupervisorIsForbidden(t *testing.T) {
+	// roles compare case-insensitively, as in hasRole
+	app := newTestApp(t, impersonationDB("Supervisor"))
+	srv := httptest.NewServer(app.Handler())
+	defer srv.Close()
+
+	if status, cookie := startImpersonation(t, app, srv); status != http.StatusForbidden || cookie != nil {
+		t.Errorf("impersonating a supervisor = %d, want 403 without a session", status)
+	}
+}
+
+func TestImpersonationIsReadOnly(t *testing.T) {
+	app := newTestApp(t, impersonationDB(RoleReviewer))
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	router := mux.NewRouter()
+	router.Use(app.AuthMiddleware)
+	router.Handle("/outbox/get", ok).Methods("GET").Name("outbox.get")
+	router.Handle("/outbox/update", ok).Methods("POST").Name("outbox.update")
+	router.Handle("/auth/impersonate/stop", ok).Methods("POST").Name("auth.impersonate.stop")
+
+	target := &AuthData{UserID: "u2", Name: "Target", Role: RoleReviewer, NIP: testTargetNIP, ImpersonatedBy: testSupervisor()}
+	cookie, _ := newTestSession(t, app, target)
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/outbox/get", http.StatusOK},
+		{"POST", "/outbox/update", http.StatusForbidden},
+		{"POST", "/auth/impersonate/stop", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.RemoteAddr = "127.0.0.1:1234"
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s while impersonating = %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+	"watcher/logging"
+)
+
+// requestIDPattern limits accepted X-Request-ID values to something safe to log.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// statusRecorder remembers the status and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// loggedRouteKey holds the *string RouteMetrics fills with the route template
+// for RequestLogger, which runs outside the router and cannot see the route.
+type loggedRouteKey struct{}
+
+// setLoggedRoute tells RequestLogger which route template served r.
+func setLoggedRoute(r *http.Request, route string) {
+	if p, ok := r.Context().Value(loggedRouteKey{}).(*string); ok {
+		*p = route
+	}
+}
+
+// RequestLogger assigns every request an ID, taken from X-Request-ID when a
+// proxy set one, returns it in the X-Request-ID response header and logs the
+// request once it is done. It logs the route template, e.g.
+// /mfwp/get/{npwp:[0-9]{15}}, instead of the path, so NPWPs and NIPs in the
+// URL and query strings do not end up in the log.
+func (app *App) RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(logging.RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = logging.NewRequestID()
+		}
+		ctx := logging.WithRequest(r.Context(), id)
+		w.Header().Set(logging.RequestIDHeader, id)
+		route := "unmatched"
+		ctx = context.WithValue(ctx, loggedRouteKey{}, &route)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logging.From(ctx).Log(ctx, level, "request",
+			"method", r.Method,
+			"route", route,
+			"status", rec.status,
+			"duration", time.Since(start),
+			"bytes", rec.bytes,
+			"ip", app.clientIP(r),
+		)
+	})
+}
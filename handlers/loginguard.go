@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"watcher/logging"
+	"watcher/response"
+
+	"github.com/gorilla/mux"
+)
+
+// Failed logins are counted separately per NIP and per client IP.
+const (
+	loginScopeNIP = "nip"
+	loginScopeIP  = "ip"
+)
+
+func loginFailKey(scope, id string) string  { return "login_fail:" + scope + ":" + id }
+func loginDelayKey(scope, id string) string { return "login_delay:" + scope + ":" + id }
+func loginLockKey(scope, id string) string  { return "login_lock:" + scope + ":" + id }
+
+// loginRetryAfter returns how long the given NIP or IP must wait before another
+// login attempt is accepted, or zero if it may try now.
+func (app *App) loginRetryAfter(ctx context.Context, scope, id string) (time.Duration, error) {
+	for _, key := range []string{loginLockKey(scope, id), loginDelayKey(scope, id)} {
+		ttl, err := app.Sessions.TTL(ctx, key)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check login throttle: %w", err)
+		}
+		if ttl > 0 {
+			return ttl, nil
+		}
+	}
+	return 0, nil
+}
+
+// recordLoginFailure counts a failed login and applies a progressive delay, or a
+// lockout once maxAttempts is reached.
+func (app *App) recordLoginFailure(ctx context.Context, scope, id string, maxAttempts int) error {
+	cfg := app.Config().Login
+
+	count, err := app.Sessions.Incr(ctx, loginFailKey(scope, id))
+	if err != nil {
+		return fmt.Errorf("failed to count login failure: %w", err)
+	}
+	if count == 1 {
+		app.Sessions.Expire(ctx, loginFailKey(scope, id), cfg.Window)
+	}
+
+	if count >= int64(maxAttempts) {
+		if err := app.Sessions.Set(ctx, loginLockKey(scope, id), strconv.FormatInt(count, 10), cfg.Lockout); err != nil {
+			return fmt.Errorf("failed to lock login: %w", err)
+		}
+		app.Sessions.Del(ctx, loginFailKey(scope, id), loginDelayKey(scope, id))
+		logging.From(ctx).Warn("login locked", "scope", scope, "id", id, "failures", count, "lockout", cfg.Lockout)
+		return nil
+	}
+
+	if over := int(count) - cfg.FreeAttempts; over > 0 {
+		delay := cfg.BaseDelay << (over - 1)
+		if delay <= 0 || delay > cfg.Lockout {
+			delay = cfg.Lockout
+		}
+		if err := app.Sessions.Set(ctx, loginDelayKey(scope, id), strconv.FormatInt(count, 10), delay); err != nil {
+			return fmt.Errorf("failed to delay login: %w", err)
+		}
+	}
+	return nil
+}
+
+// clearLoginFailures resets the counters, delay and lockout of a NIP or IP.
+func (app *App) clearLoginFailures(ctx context.Context, scope, id string) error {
+	return app.Sessions.Del(ctx, loginFailKey(scope, id), loginDelayKey(scope, id), loginLockKey(scope, id))
+}
+
+// checkLoginThrottle rejects the request with 429 when the NIP or client IP is
+// delayed or locked out. It reports whether the login may proceed.
+func (app *App) checkLoginThrottle(w http.ResponseWriter, r *http.Request, nip string) bool {
+	ctx := r.Context()
+	for _, target := range [][2]string{{loginScopeNIP, nip}, {loginScopeIP, app.clientIP(r)}} {
+		wait, err := app.loginRetryAfter(ctx, target[0], target[1])
+		if err != nil {
+			response.Internal(w, r, "Failed to check login throttling", err)
+			return false
+		}
+		if wait > 0 {
+			seconds := int(wait.Round(time.Second) / time.Second)
+			if seconds < 1 {
+				seconds = 1
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			response.ErrorData(w, r, response.CodeTooManyRequests, fmt.Sprintf("Too many failed login attempts, retry in %d seconds", seconds),
+				map[string]int{"retry_after": seconds})
+			return false
+		}
+	}
+	return true
+}
+
+// recordLoginFailures counts a failed login against both the NIP and client IP.
+func (app *App) recordLoginFailures(r *http.Request, nip string) {
+	ctx := r.Context()
+	if err := app.recordLoginFailure(ctx, loginScopeNIP, nip, app.Config().Login.MaxAttempts); err != nil {
+		logging.From(ctx).Error("failed to record login failure", "error", err)
+	}
+	if err := app.recordLoginFailure(ctx, loginScopeIP, app.clientIP(r), app.Config().Login.MaxAttemptsIP); err != nil {
+		logging.From(ctx).Error("failed to record login failure", "error", err)
+	}
+}
+
+// UnlockLoginHandler clears the failed-login state of the NIP in the URL, and of
+// a client IP when given as ?ip=.
+func (app *App) UnlockLoginHandler(w http.ResponseWriter, r *http.Request) {
+	nip := mux.Vars(r)["nip"]
+	ip := r.URL.Query().Get("ip")
+
+	if err := app.clearLoginFailures(r.Context(), loginScopeNIP, nip); err != nil {
+		response.Internal(w, r, "Failed to unlock NIP", err)
+		return
+	}
+	if ip != "" {
+		if err := app.clearLoginFailures(r.Context(), loginScopeIP, ip); err != nil {
+			response.Internal(w, r, "Failed to unlock IP", err)
+			return
+		}
+	}
+
+	logging.From(r.Context()).Info("login unlocked", "nip", nip, "ip", ip)
+
+	response.OK(w, r, "Login unlocked", nil)
+}
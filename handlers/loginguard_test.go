@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"watcher/config"
+	"watcher/store"
+)
+
+// newLoginGuardTestApp returns an App whose doctracer knows nip with the
+// password "right-password", throttled by login.
+func newLoginGuardTestApp(t *testing.T, nip string, login config.LoginConfig) *App {
+	t.Helper()
+	hash, err := HashPassword("right-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &fakeDB{query: func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		switch {
+		case strings.Contains(query, "FROM users WHERE nip = ?"):
+			columns := []string{"user_id", "role", "name", "nip", "jabatan", "department_id", "password"}
+			if args[0].Value != nip {
+				return columns, nil, nil
+			}
+			return columns, [][]driver.Value{{"u1", RoleReviewer, "Test User", nip, "Pelaksana", "D01", hash}}, nil
+		case strings.Contains(query, "FROM user_totp"):
+			return []string{"nip", "secret", "enabled", "recovery_codes"}, nil, nil
+		}
+		return nil, nil, errors.New("unexpected query: " + query)
+	}}
+	app := newTestApp(t, db)
+	cfg := *app.Config()
+	cfg.Login = login
+	app.SetConfig(&cfg)
+	return app
+}
+
+func postLogin(t *testing.T, app *App, remote, nip, password string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(LoginRequest{NIP: nip, Password: password})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(string(body)))
+	req.RemoteAddr = remote
+	rec := httptest.NewRecorder()
+	app.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRecordLoginFailureDelays(t *testing.T) {
+	const nip = "198001012000011001"
+	app := newLoginGuardTestApp(t, nip, config.LoginConfig{
+		MaxAttempts:  6,
+		FreeAttempts: 2,
+		BaseDelay:    time.Second,
+		Window:       time.Minute,
+		Lockout:      3 * time.Second,
+	})
+	ctx := context.Background()
+
+	// free, free, 1s, 2s, 4s capped at the lockout, then the lockout itself
+	for i, want := range []time.Duration{0, 0, time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		if err := app.recordLoginFailure(ctx, loginScopeNIP, nip, 6); err != nil {
+			t.Fatal(err)
+		}
+		wait, err := app.loginRetryAfter(ctx, loginScopeNIP, nip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wait > want || wait < want-100*time.Millisecond {
+			t.Errorf("after %d failures: retry after %v, want %v", i+1, wait, want)
+		}
+	}
+
+	if ttl, _ := app.Sessions.TTL(ctx, loginLockKey(loginScopeNIP, nip)); ttl <= 0 {
+		t.Error("no lockout after max_attempts failures")
+	}
+	for _, key := range []string{loginFailKey(loginScopeNIP, nip), loginDelayKey(loginScopeNIP, nip)} {
+		if _, err := app.Sessions.Get(ctx, key); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("%s kept after the lockout: %v", key, err)
+		}
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	const nip = "198001012000011001"
+	app := newLoginGuardTestApp(t, nip, config.LoginConfig{
+		MaxAttempts:   2,
+		MaxAttemptsIP: 3,
+		FreeAttempts:  10,
+		BaseDelay:     time.Second,
+		Window:        time.Minute,
+		Lockout:       time.Minute,
+	})
+
+	for i := 0; i < 2; i++ {
+		if rec := postLogin(t, app, "203.0.113.5:1234", nip, "wrong-password"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("failed login %d = %d, want 401", i+1, rec.Code)
+		}
+	}
+
+	rec := postLogin(t, app, "198.51.100.7:1234", nip, "right-password")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("login of a locked NIP = %d, want 429", rec.Code)
+	}
+	if retry := rec.Header().Get("Retry-After"); retry != "60" {
+		t.Errorf("Retry-After = %q, want 60", retry)
+	}
+	var env envelope
+	if err := json.NewDecoder(rec.Body).Decode(&env); err != nil {
+		t.Fatal(err)
+	}
+	var data struct {
+		RetryAfter int `json:"retry_after"`
+	}
+	if err := json.Unmarshal(env.Data, &data); err != nil || data.RetryAfter != 60 {
+		t.Errorf("429 data = %s, want retry_after 60", env.Data)
+	}
+
+	// a third failure from the same IP, at another NIP, reaches max_attempts_ip
+	if rec := postLogin(t, app, "203.0.113.5:1234", "199001012000011002", "guess"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("failed login of another NIP = %d, want 401", rec.Code)
+	}
+	if err := app.clearLoginFailures(context.Background(), loginScopeNIP, nip); err != nil {
+		t.Fatal(err)
+	}
+	if rec := postLogin(t, app, "203.0.113.5:1234", nip, "right-password"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("login from a locked IP = %d, want 429", rec.Code)
+	}
+	if rec := postLogin(t, app, "198.51.100.7:1234", nip, "right-password"); rec.Code != http.StatusOK {
+		t.Errorf("login from another IP = %d, want 200", rec.Code)
+	}
+}
+
+func TestLoginSuccessKeepsIPFailures(t *testing.T) {
+	const nip = "198001012000011001"
+	app := newLoginGuardTestApp(t, nip, config.LoginConfig{
+		MaxAttempts:   5,
+		MaxAttemptsIP: 5,
+		FreeAttempts:  5,
+		BaseDelay:     time.Second,
+		Window:        time.Minute,
+		Lockout:       time.Minute,
+	})
+	ctx := context.Background()
+
+	if rec := postLogin(t, app, "203.0.113.5:1234", nip, "wrong-password"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("failed login = %d, want 401", rec.Code)
+	}
+	if rec := postLogin(t, app, "203.0.113.5:1234", nip, "right-password"); rec.Code != http.StatusOK {
+		t.Fatalf("login = %d, want 200", rec.Code)
+	}
+
+	if _, err := app.Sessions.Get(ctx, loginFailKey(loginScopeNIP, nip)); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("NIP failures kept after a successful login: %v", err)
+	}
+	if count, err := app.Sessions.Get(ctx, loginFailKey(loginScopeIP, "203.0.113.5")); err != nil || count != "1" {
+		t.Errorf("IP failures after a successful login = %q, %v; want 1", count, err)
+	}
+}
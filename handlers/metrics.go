@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+	"watcher/metrics"
+	"watcher/response"
+
+	"github.com/gorilla/mux"
+)
+
+// RouteMetrics counts and times requests by the path template of the matched
+// route, e.g. /mfwp/get/{npwp:[0-9]{15}}, so NPWPs and user IDs do not end
+// up in label values. Requests no route matched are labelled "unmatched".
+// The template is also handed to RequestLogger for the request log line.
+func (app *App) RouteMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		setLoggedRoute(r, route)
+		metrics.HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		metrics.HTTPDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// MetricsHandler serves the Prometheus metrics to the addresses listed in
+// metrics.allowed, and 404 when metrics.enabled is off.
+func (app *App) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := app.Config().Metrics
+	if !cfg.Enabled {
+		response.Error(w, r, response.CodeNotFound, "Not found")
+		return
+	}
+	if len(cfg.Allowed) > 0 {
+		addr, ok := app.clientAddr(r)
+		if !ok || !containsAddr(parsePrefixes(cfg.Allowed), addr) {
+			response.Error(w, r, response.CodeForbidden, "Forbidden: address not allowed to read metrics")
+			return
+		}
+	}
+	metrics.Handler().ServeHTTP(w, r)
+}
@@ -2,58 +2,47 @@ package handlers
 
 import (
 	"database/sql"
-	"encoding/json"
 	"net/http"
 	"regexp"
-	"watcher/config"
+	"watcher/logging"
+	"watcher/response"
 
 	"github.com/gorilla/mux"
 )
 
-func GetMfwpData(w http.ResponseWriter, r *http.Request) {
+func (app *App) GetMfwpData(w http.ResponseWriter, r *http.Request) {
 	var _ *sql.DB
 	vars := mux.Vars(r)
 	npwp := vars["npwp"]
 
-	print(npwp)
-
 	// Validate NPWP: must be 15 digits
 	if match, _ := regexp.MatchString(`^\d{15}$`, npwp); !match {
-
-		print("npwp invalid \n")
-		http.Error(w, "Invalid NPWP format. It must be 15 digits.", http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{
-			"status":  "false",
-			"message": "NPWP must be exactly 15 numeric digits",
-		})
+		logging.From(r.Context()).Debug("invalid NPWP format")
+		response.Error(w, r, response.CodeInvalidRequest, "NPWP must be exactly 15 numeric digits")
 		return
 	}
 
-	db, ok := config.DB["mfwp"]
-	if !ok {
-		http.Error(w, "Database connection for 'mfwp' not found", http.StatusInternalServerError)
-		return
-	}
+	db := app.Database("mfwp") // connected, the route goes through RequireDatabase
 
 	rows, err := db.Query("SELECT * FROM masterfile WHERE NPWP_15 = ? LIMIT 1", npwp)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Internal(w, r, "Failed to query masterfile", err)
 		return
 	}
 	defer rows.Close()
 
 	if !rows.Next() {
 		if err := rows.Err(); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			response.Internal(w, r, "Failed to query masterfile", err)
 		} else {
-			http.NotFound(w, r)
+			response.Error(w, r, response.CodeNotFound, "NPWP not found")
 		}
 		return
 	}
 
 	cols, err := rows.Columns()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Internal(w, r, "Failed to read masterfile columns", err)
 		return
 	}
 
@@ -65,7 +54,7 @@ func GetMfwpData(w http.ResponseWriter, r *http.Request) {
 
 	err = rows.Scan(valuePtrs...)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Internal(w, r, "Failed to read masterfile row", err)
 		return
 	}
 
@@ -80,6 +69,5 @@ func GetMfwpData(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+	response.OK(w, r, "", result)
 }
@@ -6,20 +6,21 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"watcher/response"
 
 	"github.com/xuri/excelize/v2"
 )
 
 // UpdateOutboxHandler reads an Excel file, converts its data to JSON, and saves it.
-func UpdateOutboxHandler(w http.ResponseWriter, r *http.Request) {
-	excelPath := filepath.Join("src", "libs", "outbox.xlsx")
-	jsonPath := "src/libs/outbox.json"
+func (app *App) UpdateOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	excelPath := filepath.Join(app.Config().Paths.Libs, "outbox.xlsx")
+	jsonPath := filepath.Join(app.Config().Paths.Libs, "outbox.json")
 	sheetName := "Sheet1"
 
 	// Open the Excel file
 	f, err := excelize.OpenFile(excelPath)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to open Excel file: %v", err), http.StatusInternalServerError)
+		response.Internal(w, r, "Failed to open Excel file", err)
 		return
 	}
 
@@ -29,12 +30,12 @@ func UpdateOutboxHandler(w http.ResponseWriter, r *http.Request) {
 	// Get all the rows from the specified sheet
 	rows, err := f.GetRows(sheetName)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get rows from sheet '%s': %v", sheetName, err), http.StatusInternalServerError)
+		response.Internal(w, r, fmt.Sprintf("Failed to get rows from sheet '%s'", sheetName), err)
 		return
 	}
 
 	if len(rows) < 2 {
-		http.Error(w, "No data found in Excel sheet or header row is missing", http.StatusBadRequest)
+		response.Error(w, r, response.CodeInvalidRequest, "No data found in Excel sheet or header row is missing")
 		return
 	}
 
@@ -57,62 +58,32 @@ func UpdateOutboxHandler(w http.ResponseWriter, r *http.Request) {
 	// Marshal data into JSON format
 	jsonData, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to marshal data to JSON: %v", err), http.StatusInternalServerError)
+		response.Internal(w, r, "Failed to marshal data to JSON", err)
 		return
 	}
 
 	// Write the JSON data to the output file
 	err = os.WriteFile(jsonPath, jsonData, 0644)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to write JSON file: %v", err), http.StatusInternalServerError)
+		response.Internal(w, r, "Failed to write JSON file", err)
 		return
 	}
 
-	// respond with object
-	wrapper := map[string]any{
-		"status":  "success",
-		"message": "Successfully converted",
-		"data":    json.RawMessage(jsonData), // embed the already marshalled JSON
-	}
-
-	// convert to json object
-	finalJSON, err := json.Marshal(wrapper)
-	if err != nil {
-		http.Error(w, "Failed to marshal wrapper", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write(finalJSON)
+	// embed the already marshalled JSON
+	response.OK(w, r, "Successfully converted", json.RawMessage(jsonData))
 }
 
 // GetOutboxData serves the content of src/outbox/data.json
-func GetOutboxData(w http.ResponseWriter, r *http.Request) {
-	jsonPath := filepath.Join("src", "libs", "outbox.json")
+func (app *App) GetOutboxData(w http.ResponseWriter, r *http.Request) {
+	jsonPath := filepath.Join(app.Config().Paths.Libs, "outbox.json")
 
 	// Read the JSON file from the disk
 	jsonData, err := os.ReadFile(jsonPath)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to read data.json: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	// Create a wrapper for the JSON data
-	wrapper := map[string]interface{}{
-		"status": "true",
-		"data":   json.RawMessage(jsonData),
-	}
-
-	// Marshal the wrapper into a JSON object
-	response, err := json.Marshal(wrapper)
-	if err != nil {
-		http.Error(w, "Failed to create response object", http.StatusInternalServerError)
+		response.Internal(w, r, "Failed to read outbox data", err)
 		return
 	}
 
-	// Set the content type and write the response
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(response)
+	// the file holds JSON written by UpdateOutboxHandler, embed it as is
+	response.OK(w, r, "", json.RawMessage(jsonData))
 }
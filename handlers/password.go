@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordCost is the bcrypt work factor used for newly hashed passwords.
+const passwordCost = 12
+
+// HashPassword returns a salted bcrypt hash of the given plaintext password.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// isPasswordHash reports whether a stored password value is a bcrypt hash
+// rather than a legacy plaintext password.
+func isPasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") ||
+		strings.HasPrefix(stored, "$2b$") ||
+		strings.HasPrefix(stored, "$2y$")
+}
+
+// verifyPassword checks a submitted password against the stored value.
+// needsRehash is true when the stored value is legacy plaintext or was hashed
+// with a lower cost than passwordCost, so the caller should replace it.
+func verifyPassword(stored, password string) (ok bool, needsRehash bool) {
+	if password == "" {
+		return false, false
+	}
+	if !isPasswordHash(stored) {
+		// legacy plaintext row, compare in constant time
+		ok = subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return ok, ok
+	}
+
+	// bcrypt ignores everything after maxPasswordBytes, so a longer password
+	// would match whatever it is followed by
+	if len(password) > maxPasswordBytes {
+		return false, false
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)); err != nil {
+		return false, false
+	}
+
+	cost, err := bcrypt.Cost([]byte(stored))
+	return true, err == nil && cost < passwordCost
+}
+
+// dummyPasswordHash returns the hash compared against when a NIP does not
+// exist so that login timing does not reveal which NIPs are registered. It is
+// computed on first use rather than at startup, which bcrypt would slow down.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("gofs-dummy-password")
+	return hash
+})
+
+// upgradePasswordHash replaces a user's stored password with a bcrypt hash.
+func (app *App) upgradePasswordHash(userID, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	_, err = app.Database("doctracer").Exec("UPDATE users SET password = ? WHERE user_id = ?", hash, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	hash, err := HashPassword("right-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	weak, err := bcrypt.GenerateFromPassword([]byte("right-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := strings.Repeat("p", maxPasswordBytes)
+	longHash, err := HashPassword(long)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		stored          string
+		password        string
+		wantOK          bool
+		wantNeedsRehash bool
+	}{
+		{"bcrypt hash", hash, "right-password", true, false},
+		{"bcrypt hash, wrong password", hash, "wrong-password", false, false},
+		{"lower cost", string(weak), "right-password", true, true},
+		{"lower cost, wrong password", string(weak), "wrong-password", false, false},
+		{"plaintext row", "right-password", "right-password", true, true},
+		{"plaintext row, wrong password", "right-password", "wrong-password", false, false},
+		{"empty plaintext row", "", "", false, false},
+		{"72 bytes", longHash, long, true, false},
+		{"longer than 72 bytes", longHash, long + "anything", false, false},
+	}
+	for _, tt := range tests {
+		ok, needsRehash := verifyPassword(tt.stored, tt.password)
+		if ok != tt.wantOK || needsRehash != tt.wantNeedsRehash {
+			t.Errorf("%s: verifyPassword = %v, %v; want %v, %v", tt.name, ok, needsRehash, tt.wantOK, tt.wantNeedsRehash)
+		}
+	}
+}
+
+func TestAuthenticateUpgradesPassword(t *testing.T) {
+	const nip = "198001012000011001"
+	current, err := HashPassword("right-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	weak, err := bcrypt.GenerateFromPassword([]byte("right-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		stored      string
+		wantUpgrade bool
+	}{
+		{"plaintext row", "right-password", true},
+		{"lower cost", string(weak), true},
+		{"current cost", current, false},
+	}
+	for _, tt := range tests {
+		var upgraded string
+		db := &fakeDB{
+			query: func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+				columns := []string{"user_id", "role", "name", "nip", "jabatan", "department_id", "password"}
+				return columns, [][]driver.Value{{"u1", RoleReviewer, "Test User", nip, "Pelaksana", "D01", tt.stored}}, nil
+			},
+			exec: func(query string, args []driver.NamedValue) (int64, error) {
+				if !strings.HasPrefix(query, "UPDATE users SET password = ?") || args[1].Value != "u1" {
+					return 0, errors.New("unexpected exec: " + query)
+				}
+				upgraded = args[0].Value.(string)
+				return 1, nil
+			},
+		}
+		app := newTestApp(t, db)
+
+		user, err := app.currentAuthenticator().Authenticate(context.Background(), nip, "right-password")
+		if err != nil || user.NIP != nip {
+			t.Fatalf("%s: Authenticate = %v, %v", tt.name, user, err)
+		}
+		if !tt.wantUpgrade {
+			if upgraded != "" {
+				t.Errorf("%s: password rehashed, want it kept", tt.name)
+			}
+			continue
+		}
+		if ok, needsRehash := verifyPassword(upgraded, "right-password"); !ok || needsRehash {
+			t.Errorf("%s: stored %q after login, want a bcrypt hash at cost %d", tt.name, upgraded, passwordCost)
+		}
+	}
+}
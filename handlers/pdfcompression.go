@@ -7,6 +7,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
+	"watcher/metrics"
+	"watcher/response"
 
 	"github.com/google/uuid"
 )
@@ -15,59 +18,51 @@ type PDFCompressionRequest struct {
 	CompressionLevel string `json:"compressionLevel"`
 }
 
+// PDFCompressionResponse is the data of the response envelope.
 type PDFCompressionResponse struct {
-	OutputPath                 string   `json:"outputPath"`
-	Message                    string   `json:"message"`
+	OutputPath                 string   `json:"outputPath,omitempty"`
 	AvailableCompressionLevels []string `json:"availableCompressionLevels"`
 }
 
 var availableLevels = []string{"25", "50", "75", "90", "ghost"}
 
-func PDFCompressionHandler(w http.ResponseWriter, r *http.Request) {
+func (app *App) PDFCompressionHandler(w http.ResponseWriter, r *http.Request) {
 	// new var to store req,body
 	var req PDFCompressionRequest
 
 	// decode r.Body store it in the var address
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		response.Error(w, r, response.CodeInvalidRequest, "Invalid request body")
 		return
 	}
 
 	if !isValidCompressionLevel(req.CompressionLevel, availableLevels) {
-		resp := PDFCompressionResponse{
-			Message:                    "Invalid compression level",
+		response.ErrorData(w, r, response.CodeInvalidRequest, "Invalid compression level", PDFCompressionResponse{
 			AvailableCompressionLevels: availableLevels,
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(resp)
+		})
 		return
 	}
 
-	inputPath := "tmp/pdfcompression/input/input.pdf"
-	outputDir := "tmp/pdfcompression/output"
+	inputPath := filepath.Join(app.Config().Paths.PDFCompressionInput(), "input.pdf")
+	outputDir := app.Config().Paths.PDFCompressionOutput()
 	outputFileName := uuid.New().String() + ".pdf"
 	outputPath := filepath.Join(outputDir, outputFileName)
 
 	if _, err := os.Stat(inputPath); os.IsNotExist(err) {
-		http.Error(w, "Input file not found", http.StatusNotFound)
+		response.Error(w, r, response.CodeNotFound, "Input file not found")
 		return
 	}
 
-	if err := compressPDF(inputPath, outputPath, req.CompressionLevel); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to compress PDF: %v", err), http.StatusInternalServerError)
+	if err := app.compressPDF(inputPath, outputPath, req.CompressionLevel); err != nil {
+		response.Internal(w, r, "Failed to compress PDF", err)
 		return
 	}
 
-	resp := PDFCompressionResponse{
+	response.OK(w, r, "PDF compressed successfully", PDFCompressionResponse{
 		OutputPath:                 outputPath,
-		Message:                    "PDF compressed successfully",
 		AvailableCompressionLevels: availableLevels,
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	})
 }
 
 func getCompressionArgs(level string) []string {
@@ -161,15 +156,18 @@ func getCompressionArgs(level string) []string {
 	return levels[level]
 }
 
-func compressPDF(inputPath, outputPath, compressionLevel string) error {
-	gsPath := "gsc"
+func (app *App) compressPDF(inputPath, outputPath, compressionLevel string) error {
+	gsPath := app.Config().Server.Ghostscript
 	args := getCompressionArgs(compressionLevel)
 	args = append(args, "-sOutputFile="+outputPath, inputPath)
 
 	cmd := exec.Command(gsPath, args...)
 
+	start := time.Now()
 	output, err := cmd.CombinedOutput()
+	metrics.GhostscriptDuration.WithLabelValues(compressionLevel).Observe(time.Since(start).Seconds())
 	if err != nil {
+		metrics.GhostscriptFailures.WithLabelValues(compressionLevel).Inc()
 		return fmt.Errorf("error: %v, output: %s", err, string(output))
 	}
 
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"net/http"
+	"watcher/apidocs"
+	"watcher/response"
+
+	"github.com/gorilla/mux" // Import Gorilla Mux
+)
+
+func skip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Handler returns the routes wrapped in request logging, for the HTTP server.
+func (app *App) Handler() http.Handler {
+	return app.RequestLogger(app.Router())
+}
+
+// routeNames returns the names of every route, which are the valid API token
+// scopes.
+func (app *App) routeNames() map[string]bool {
+	names := make(map[string]bool)
+	app.Router().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		if name := route.GetName(); name != "" {
+			names[name] = true
+		}
+		return nil
+	})
+	return names
+}
+
+// Router returns the routes of the application, ready for http.ListenAndServe
+// or httptest.NewServer.
+func (app *App) Router() *mux.Router {
+	router := mux.NewRouter() // Create a new Gorilla Mux router
+
+	// request counts and latency per route template; 404/405 are counted too
+	router.Use(app.RouteMetrics)
+	router.NotFoundHandler = app.RouteMetrics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response.Error(w, r, response.CodeNotFound, "No route for "+r.URL.Path)
+	}))
+	router.MethodNotAllowedHandler = app.RouteMetrics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response.Error(w, r, response.CodeMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+	}))
+
+	// cookie-authenticated POST/PUT/DELETE must carry the session's X-CSRF-Token
+	router.Use(app.CSRFMiddleware)
+
+	// Public routes (no authentication required)
+	router.HandleFunc("/auth/login", app.LoginHandler).Methods("POST").Name("auth.login")
+	router.HandleFunc("/auth/login/2fa", app.LoginTwoFactorHandler).Methods("POST").Name("auth.login.2fa")
+	// enrollment takes either a session or the challenge of a pending login
+	router.HandleFunc("/auth/2fa/enroll", app.EnrollTwoFactorHandler).Methods("POST")
+	router.HandleFunc("/auth/2fa/confirm", app.ConfirmTwoFactorHandler).Methods("POST")
+	// Prometheus scrapes without a session, limited to metrics.allowed
+	router.HandleFunc("/metrics", app.MetricsHandler).Methods("GET").Name("metrics")
+	// probes for the process supervisor / load balancer
+	router.HandleFunc("/healthz", HealthzHandler).Methods("GET").Name("healthz")
+	router.HandleFunc("/readyz", app.ReadyzHandler).Methods("GET").Name("readyz")
+	// OpenAPI document and its viewer, see package apidocs
+	router.HandleFunc("/openapi.json", apidocs.SpecHandler).Methods("GET").Name("openapi")
+	router.HandleFunc("/api-docs", apidocs.ViewerHandler).Methods("GET").Name("api-docs")
+
+	// ------------ Auth Middleware ---------------------
+	authenticatedRouter := router.PathPrefix("/").Subrouter()
+	// uncomment lines below
+	// authenticatedRouter.Use(app.AuthMiddleware)
+	// authenticatedRouter.Use(app.AuthorizeMiddleware) // role check, see permissions in config.yaml
+
+	//! ---------- no auth --- dev only --
+	//! to activate auth on route,comment line below and uncomment out the auth middleware
+	authenticatedRouter.Use(skip)
+
+	// ---------- route requiring authentication
+	// route names are the keys of the permissions matrix in config.yaml
+	authenticatedRouter.HandleFunc("/", HomeHandler).Methods("GET").Name("home")
+
+	authenticatedRouter.HandleFunc("/outbox/update", app.UpdateOutboxHandler).Methods("POST").Name("outbox.update")
+	authenticatedRouter.HandleFunc("/outbox/get", app.GetOutboxData).Methods("GET").Name("outbox.get")
+	authenticatedRouter.HandleFunc("/docvault/update", app.UpdateDocVaultHandler).Methods("POST").Name("docvault.update")
+	authenticatedRouter.HandleFunc("/docvault/get", app.GetDocVaultHandler).Methods("GET").Name("docvault.get")
+	authenticatedRouter.HandleFunc("/auth/session", app.GetSessionHandler).Methods("GET").Name("auth.session")
+	authenticatedRouter.HandleFunc("/auth/logout", app.LogoutHandler).Methods("POST").Name("auth.logout")
+	authenticatedRouter.HandleFunc("/auth/sessions", app.ListSessionsHandler).Methods("GET").Name("auth.sessions")
+	authenticatedRouter.Handle("/auth/sessions/revoke/{nip:[0-9]+}", app.RequireRoles(RoleSupervisor)(http.HandlerFunc(app.RevokeUserSessionsHandler))).Methods("POST").Name("auth.sessions.revoke")
+	authenticatedRouter.HandleFunc("/auth/tokens", app.CreateAPITokenHandler).Methods("POST").Name("auth.tokens.create")
+	authenticatedRouter.HandleFunc("/auth/tokens", app.ListAPITokensHandler).Methods("GET").Name("auth.tokens.list")
+	authenticatedRouter.HandleFunc("/auth/tokens/{id}", app.RevokeAPITokenHandler).Methods("DELETE").Name("auth.tokens.revoke")
+	authenticatedRouter.HandleFunc("/auth/2fa/disable", app.DisableTwoFactorHandler).Methods("POST").Name("auth.2fa.disable")
+	authenticatedRouter.HandleFunc("/auth/2fa/policy", app.GetTwoFactorPolicyHandler).Methods("GET").Name("auth.2fa.policy")
+	authenticatedRouter.Handle("/auth/2fa/policy", app.RequireRoles(RoleSupervisor)(http.HandlerFunc(app.UpdateTwoFactorPolicyHandler))).Methods("PUT").Name("auth.2fa.policy.update")
+	authenticatedRouter.Handle("/auth/impersonate/{nip:[0-9]+}", app.RequireRoles(RoleSupervisor)(http.HandlerFunc(app.StartImpersonationHandler))).Methods("POST").Name("auth.impersonate")
+	authenticatedRouter.HandleFunc("/auth/impersonate/stop", app.StopImpersonationHandler).Methods("POST").Name("auth.impersonate.stop")
+	authenticatedRouter.Handle("/auth/impersonations", app.RequireRoles(RoleSupervisor)(http.HandlerFunc(app.ListImpersonationAuditHandler))).Methods("GET").Name("auth.impersonations")
+	authenticatedRouter.Handle("/auth/unlock/{nip:[0-9]+}", app.RequireRoles(RoleSupervisor)(http.HandlerFunc(app.UnlockLoginHandler))).Methods("POST").Name("auth.unlock")
+	authenticatedRouter.Handle("/mfwp/get/{npwp:[0-9]{15}}", app.RequireDatabase("mfwp")(http.HandlerFunc(app.GetMfwpData))).Methods("GET").Name("mfwp.get")
+	authenticatedRouter.HandleFunc("/utils/pdfcompression", app.PDFCompressionHandler).Methods("POST").Name("utils.pdfcompression")
+	authenticatedRouter.Handle("/docs/generate", app.RequireDatabase("documentations")(http.HandlerFunc(app.DocsGenerateHandler))).Methods("POST").Name("docs.generate") // generate markdown from based on /raw/*
+	authenticatedRouter.HandleFunc("/docs/create", app.CreateDocHandler).Methods("POST").Name("docs.create")                                                             // init new documentation
+
+	// ---------- user and role management, supervisors only
+	usersRouter := authenticatedRouter.PathPrefix("/users").Subrouter()
+	usersRouter.Use(app.RequireRoles(RoleSupervisor))
+	usersRouter.HandleFunc("", app.ListUsersHandler).Methods("GET").Name("users.list")
+	usersRouter.HandleFunc("", app.CreateUserHandler).Methods("POST").Name("users.create")
+	usersRouter.HandleFunc("/{userId}", app.GetUserHandler).Methods("GET").Name("users.get")
+	usersRouter.HandleFunc("/{userId}", app.UpdateUserHandler).Methods("PUT").Name("users.update")
+	usersRouter.HandleFunc("/{userId}/role", app.UpdateUserRoleHandler).Methods("PUT").Name("users.role")
+	usersRouter.HandleFunc("/{userId}/password", app.ResetUserPasswordHandler).Methods("POST").Name("users.password")
+	usersRouter.HandleFunc("/{userId}/deactivate", app.DeactivateUserHandler).Methods("POST").Name("users.deactivate")
+	usersRouter.HandleFunc("/{userId}/activate", app.ActivateUserHandler).Methods("POST").Name("users.activate")
+
+	return router
+}
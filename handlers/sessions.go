@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+	"watcher/logging"
+	"watcher/response"
+	"watcher/store"
+
+	"github.com/gorilla/mux"
+)
+
+// errSessionExpired is returned when a session has outlived its absolute lifetime.
+var errSessionExpired = errors.New("session expired")
+
+// SessionInfo describes one active session of a user, without exposing its token.
+type SessionInfo struct {
+	ID        string    `json:"id"`
+	Device    string    `json:"device"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	Current   bool      `json:"current"`
+}
+
+// sessionKey is the string holding the AuthData of a session. Tokens are
+// prefixed like every other key, so they cannot collide with them.
+func sessionKey(token string) string {
+	return "session:" + token
+}
+
+// sessionIndexKey is the set holding every session token of a NIP.
+func sessionIndexKey(nip string) string {
+	return "sessions:" + nip
+}
+
+// impersonationIndexKey is the set holding every impersonation session acting
+// as a NIP. Those sessions belong to the supervisor's index, this one lets the
+// target's revocation end them too.
+func impersonationIndexKey(nip string) string {
+	return "impersonations:" + nip
+}
+
+// sessionOwner is the NIP whose index a session is listed and revoked under:
+// the supervisor for an impersonation session, the user otherwise.
+func sessionOwner(user *AuthData) string {
+	if user.ImpersonatedBy != nil {
+		return user.ImpersonatedBy.NIP
+	}
+	return user.NIP
+}
+
+// sessionMetaKey is the hash holding device, IP and timestamps of a session.
+func sessionMetaKey(token string) string {
+	return "session_meta:" + token
+}
+
+// sessionID derives a stable public identifier from a session token so sessions
+// can be listed without leaking the token itself.
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// registerSession adds a freshly created session to its owner's session index and
+// records its CSRF token, any extra metadata and the absolute deadline after
+// which it can no longer be renewed.
+func (app *App) registerSession(ctx context.Context, token, csrf string, user AuthData, r *http.Request, lifetime time.Duration, extra map[string]string) error {
+	now := time.Now()
+	meta := map[string]string{
+		"nip":        user.NIP,
+		"device":     r.UserAgent(),
+		"ip":         user.IP,
+		"created_at": now.Format(time.RFC3339),
+		"last_seen":  now.Format(time.RFC3339),
+		"expires_at": now.Add(lifetime).Format(time.RFC3339),
+		"csrf":       csrf,
+	}
+	for field, value := range extra {
+		meta[field] = value
+	}
+
+	owner := sessionOwner(&user)
+	absoluteLifetime := app.Config().Session.AbsoluteLifetime
+	return app.Sessions.Atomic(ctx, func(tx store.Writer) error {
+		tx.HSet(ctx, sessionMetaKey(token), meta)
+		tx.Expire(ctx, sessionMetaKey(token), lifetime)
+		tx.SAdd(ctx, sessionIndexKey(owner), token)
+		tx.Expire(ctx, sessionIndexKey(owner), absoluteLifetime)
+		if owner != user.NIP {
+			tx.SAdd(ctx, impersonationIndexKey(user.NIP), token)
+			tx.Expire(ctx, impersonationIndexKey(user.NIP), absoluteLifetime)
+		}
+		return nil
+	})
+}
+
+// refreshSession slides the idle timeout of a session forward, capped at its
+// absolute deadline. The store TTLs are renewed in one transaction and the cookie
+// is only re-issued once the store has accepted the new expiry.
+func (app *App) refreshSession(ctx context.Context, w http.ResponseWriter, token string, user *AuthData) error {
+	expiresAt, err := app.Sessions.HGet(ctx, sessionMetaKey(token), "expires_at")
+	if err != nil {
+		return fmt.Errorf("failed to read session deadline: %w", err)
+	}
+
+	deadline, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return fmt.Errorf("invalid session deadline: %w", err)
+	}
+
+	now := time.Now()
+	ttl := app.Config().Session.IdleTimeout
+	if remaining := deadline.Sub(now); remaining < ttl {
+		ttl = remaining
+	}
+	if ttl <= 0 {
+		app.deleteSession(ctx, token, user)
+		clearSessionCookie(w)
+		return errSessionExpired
+	}
+
+	err = app.Sessions.Atomic(ctx, func(tx store.Writer) error {
+		tx.Expire(ctx, sessionKey(token), ttl)
+		tx.HSet(ctx, sessionMetaKey(token), map[string]string{"last_seen": now.Format(time.RFC3339)})
+		tx.ExpireAt(ctx, sessionMetaKey(token), deadline)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to renew session: %w", err)
+	}
+
+	setSessionCookie(w, token, now.Add(ttl))
+	return nil
+}
+
+// deleteSession removes a session token, its metadata and its index entries.
+func (app *App) deleteSession(ctx context.Context, token string, user *AuthData) error {
+	return app.Sessions.Atomic(ctx, func(tx store.Writer) error {
+		tx.Del(ctx, sessionKey(token), sessionMetaKey(token))
+		tx.SRem(ctx, sessionIndexKey(sessionOwner(user)), token)
+		if user.ImpersonatedBy != nil {
+			tx.SRem(ctx, impersonationIndexKey(user.NIP), token)
+		}
+		return nil
+	})
+}
+
+// listSessions returns the active sessions of a NIP, pruning index entries whose
+// session has already expired.
+func (app *App) listSessions(ctx context.Context, nip, currentToken string) ([]SessionInfo, error) {
+	tokens, err := app.Sessions.SMembers(ctx, sessionIndexKey(nip))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session index: %w", err)
+	}
+
+	sessions := make([]SessionInfo, 0, len(tokens))
+	for _, token := range tokens {
+		meta, err := app.Sessions.HGetAll(ctx, sessionMetaKey(token))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read session metadata: %w", err)
+		}
+
+		exists, err := app.Sessions.Exists(ctx, sessionKey(token))
+		if err != nil {
+			return nil, fmt.Errorf("failed to check session: %w", err)
+		}
+		if !exists || len(meta) == 0 {
+			app.Sessions.SRem(ctx, sessionIndexKey(nip), token)
+			continue
+		}
+
+		createdAt, _ := time.Parse(time.RFC3339, meta["created_at"])
+		lastSeen, _ := time.Parse(time.RFC3339, meta["last_seen"])
+		sessions = append(sessions, SessionInfo{
+			ID:        sessionID(token),
+			Device:    meta["device"],
+			IP:        meta["ip"],
+			CreatedAt: createdAt,
+			LastSeen:  lastSeen,
+			Current:   token == currentToken,
+		})
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+	return sessions, nil
+}
+
+// revokeUserSessions deletes every session of a NIP, including impersonation
+// sessions it started or that act as it, and returns how many were removed.
+func (app *App) revokeUserSessions(ctx context.Context, nip string) (int, error) {
+	tokens, err := app.Sessions.SMembers(ctx, sessionIndexKey(nip))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read session index: %w", err)
+	}
+	impersonations, err := app.Sessions.SMembers(ctx, impersonationIndexKey(nip))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read impersonation index: %w", err)
+	}
+	tokens = append(tokens, impersonations...)
+
+	keys := []string{sessionIndexKey(nip), impersonationIndexKey(nip)}
+	for _, token := range tokens {
+		keys = append(keys, sessionKey(token), sessionMetaKey(token))
+	}
+
+	if err := app.Sessions.Del(ctx, keys...); err != nil {
+		return 0, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	return len(tokens), nil
+}
+
+// setSessionCookie issues the HttpOnly session_token cookie.
+func setSessionCookie(w http.ResponseWriter, token string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_token",
+		Value:    token,
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   false, // vscode client
+		// Secure:   true, // if using real client
+		SameSite: http.SameSiteLaxMode, // not sent on cross-site POSTs
+		Path:     "/",                  // use cookies on all path
+	})
+}
+
+// clearSessionCookie tells the browser to drop the session_token cookie.
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_token",
+		Value:    "",
+		MaxAge:   -1,
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+		Secure:   false, // vscode client
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/",
+	})
+}
+
+// LogoutHandler deletes the current session from the store and clears the cookie.
+func (app *App) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	authData, err := app.getSessionData(r)
+	if err != nil {
+		clearSessionCookie(w)
+		response.Error(w, r, response.CodeUnauthorized, err.Error())
+		return
+	}
+
+	cookie, _ := r.Cookie("session_token")
+	if err := app.deleteSession(r.Context(), cookie.Value, authData); err != nil {
+		response.Internal(w, r, "Failed to delete session", err)
+		return
+	}
+	clearSessionCookie(w)
+
+	response.OK(w, r, "Logout successful", nil)
+}
+
+// ListSessionsHandler returns the active sessions of the logged-in user.
+func (app *App) ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	authData, err := app.getSessionData(r)
+	if err != nil {
+		response.Error(w, r, response.CodeUnauthorized, err.Error())
+		return
+	}
+
+	cookie, _ := r.Cookie("session_token")
+	sessions, err := app.listSessions(r.Context(), authData.NIP, cookie.Value)
+	if err != nil {
+		response.Internal(w, r, "Failed to list sessions", err)
+		return
+	}
+
+	response.OK(w, r, "", sessions)
+}
+
+// RevokeUserSessionsHandler deletes every session of the NIP in the URL, e.g. when
+// a member of staff leaves or rotates.
+func (app *App) RevokeUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	nip := mux.Vars(r)["nip"]
+
+	count, err := app.revokeUserSessions(r.Context(), nip)
+	if err != nil {
+		response.Internal(w, r, "Failed to revoke sessions", err)
+		return
+	}
+
+	logging.From(r.Context()).Info("sessions revoked", "nip", nip, "removed", count)
+
+	response.OK(w, r, "", map[string]any{"nip": nip, "revoked": count})
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of RFC 6238 Appendix B, "12345678901234567890".
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// Appendix B lists 8 digits, totpCode keeps the last totpDigits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		got, err := totpCode(rfc6238Secret, totpStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := tt.want[len(tt.want)-totpDigits:]; got != want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, want)
+		}
+	}
+}
+
+func TestTOTPCodeSecret(t *testing.T) {
+	upper, err := totpCode(rfc6238Secret, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lower, err := totpCode(strings.ToLower(rfc6238Secret), 1); err != nil || lower != upper {
+		t.Errorf("lower-case secret = %q, %v; want %q", lower, err, upper)
+	}
+	if _, err := totpCode("not base32!", 1); err == nil {
+		t.Error("invalid secret accepted")
+	}
+}
+
+func TestMatchTOTPWindow(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := totpStep(now)
+	code := func(step int64) string {
+		c, err := totpCode(rfc6238Secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	for _, step := range []int64{current - 1, current, current + 1} {
+		matched, ok := matchTOTP(rfc6238Secret, code(step), now)
+		if !ok || matched != step {
+			t.Errorf("code of step %+d = %d, %v; want it matched at its step", step-current, matched, ok)
+		}
+	}
+	for _, step := range []int64{current - 2, current + 2} {
+		if _, ok := matchTOTP(rfc6238Secret, code(step), now); ok {
+			t.Errorf("code of step %+d accepted outside the window", step-current)
+		}
+	}
+	if _, ok := matchTOTP(rfc6238Secret, " "+code(current)+"\n", now); !ok {
+		t.Error("code with surrounding whitespace rejected")
+	}
+	if _, ok := matchTOTP(rfc6238Secret, code(current)[1:], now); ok {
+		t.Error("short code accepted")
+	}
+}
+
+func TestVerifySecondFactorRefusesReplay(t *testing.T) {
+	app := newTestApp(t, &fakeDB{})
+	rec := &twoFactorRecord{NIP: "198001012000011001", Secret: rfc6238Secret, Enabled: true}
+	code, err := totpCode(rfc6238Secret, totpStep(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if ok, err := app.verifySecondFactor(ctx, rec, code, ""); !ok || err != nil {
+		t.Fatalf("first use = %v, %v; want accepted", ok, err)
+	}
+	if ok, err := app.verifySecondFactor(ctx, rec, code, ""); ok || err != nil {
+		t.Errorf("second use = %v, %v; want refused", ok, err)
+	}
+}
+
+func TestVerifySecondFactorRecoveryCodeSingleUse(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := `["` + strings.Join(hashes, `","`) + `"]`
+	load := func() *twoFactorRecord {
+		rec := &twoFactorRecord{NIP: "198001012000011001", Secret: rfc6238Secret, Enabled: true, storedCodes: stored}
+		rec.RecoveryCodes = append([]string(nil), hashes...)
+		return rec
+	}
+
+	// user_totp with its conditional UPDATE of recovery_codes
+	db := &fakeDB{exec: func(query string, args []driver.NamedValue) (int64, error) {
+		if !strings.HasPrefix(query, "UPDATE user_totp SET recovery_codes") {
+			return 0, errors.New("unexpected exec: " + query)
+		}
+		if args[2].Value != stored {
+			return 0, nil
+		}
+		stored = args[0].Value.(string)
+		return 1, nil
+	}}
+	app := newTestApp(t, db)
+	ctx := context.Background()
+
+	rec, parallel := load(), load()
+	if ok, err := app.verifySecondFactor(ctx, rec, "", strings.ToUpper(codes[3])); !ok || err != nil {
+		t.Fatalf("first use = %v, %v; want accepted", ok, err)
+	}
+	if len(rec.RecoveryCodes) != recoveryCodeCount-1 {
+		t.Errorf("%d recovery codes left, want %d", len(rec.RecoveryCodes), recoveryCodeCount-1)
+	}
+	if ok, err := app.verifySecondFactor(ctx, rec, "", codes[3]); ok || err != nil {
+		t.Errorf("second use = %v, %v; want refused", ok, err)
+	}
+	// a request that loaded the codes before the first use consumed one
+	if ok, err := app.verifySecondFactor(ctx, parallel, "", codes[3]); ok || err != nil {
+		t.Errorf("parallel use = %v, %v; want refused", ok, err)
+	}
+	if ok, err := app.verifySecondFactor(ctx, load(), "", "aaaaa-bbbbb"); ok || err != nil {
+		t.Errorf("unknown code = %v, %v; want refused", ok, err)
+	}
+}
@@ -0,0 +1,569 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"watcher/logging"
+	"watcher/metrics"
+	"watcher/response"
+	"watcher/store"
+
+	"github.com/google/uuid"
+	"github.com/skip2/go-qrcode"
+)
+
+// recoveryCodeCount is how many single-use recovery codes are issued on enrollment.
+const recoveryCodeCount = 10
+
+// maxTwoFactorAttempts is how many wrong codes a pending login may submit.
+const maxTwoFactorAttempts = 5
+
+// twoFactorPolicyKey holds the roles required to use 2FA when a supervisor has
+// overridden two_factor.required_roles from config.yaml.
+const twoFactorPolicyKey = "2fa_required_roles"
+
+// twoFactorRecord is a row of the user_totp table.
+type twoFactorRecord struct {
+	NIP           string
+	Secret        string
+	Enabled       bool
+	RecoveryCodes []string // SHA-256 hashes of unused recovery codes
+
+	storedCodes string // recovery_codes as read, the condition of consumeRecoveryCode
+}
+
+// pendingLogin is a login that passed the password check and awaits its second
+// factor. It is kept in the session store under login_2fa:<challenge>.
+type pendingLogin struct {
+	User     AuthData `json:"user"`
+	Enrolled bool     `json:"enrolled"`
+}
+
+// TwoFactorRequest is the payload of the /auth/2fa and /auth/login/2fa routes.
+// Challenge is only needed when the caller has no session yet.
+type TwoFactorRequest struct {
+	Challenge    string `json:"challenge"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// TwoFactorPolicy lists the roles that must use two-factor authentication.
+type TwoFactorPolicy struct {
+	RequiredRoles []string `json:"required_roles"`
+}
+
+func pendingLoginKey(challenge string) string {
+	return "login_2fa:" + challenge
+}
+
+// pendingLoginAttemptsKey counts the codes submitted for a challenge. It is
+// a counter of its own so parallel requests cannot overwrite each other.
+func pendingLoginAttemptsKey(challenge string) string {
+	return "login_2fa_attempts:" + challenge
+}
+
+// loadTwoFactor returns the TOTP enrollment of a NIP, or nil if there is none.
+func (app *App) loadTwoFactor(ctx context.Context, nip string) (*twoFactorRecord, error) {
+	var rec twoFactorRecord
+	row := app.Database("doctracer").QueryRowContext(ctx, "SELECT nip, secret, enabled, recovery_codes FROM user_totp WHERE nip = ?", nip)
+	err := row.Scan(&rec.NIP, &rec.Secret, &rec.Enabled, &rec.storedCodes)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load two-factor enrollment: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(rec.storedCodes), &rec.RecoveryCodes); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal recovery codes: %w", err)
+	}
+	return &rec, nil
+}
+
+// consumeRecoveryCode stores remaining as the recovery codes of rec, but only
+// if they have not changed since rec was loaded. It reports false when a
+// parallel request consumed a code first, so a code is never used twice.
+func (app *App) consumeRecoveryCode(ctx context.Context, rec *twoFactorRecord, remaining []string) (bool, error) {
+	codes, err := json.Marshal(remaining)
+	if err != nil {
+		return false, err
+	}
+	result, err := app.Database("doctracer").ExecContext(ctx,
+		"UPDATE user_totp SET recovery_codes = ? WHERE nip = ? AND recovery_codes = ?", string(codes), rec.NIP, rec.storedCodes)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		return false, nil
+	}
+	rec.RecoveryCodes = remaining
+	rec.storedCodes = string(codes)
+	return true, nil
+}
+
+// requiredTwoFactorRoles returns the runtime policy set by a supervisor, or the
+// default from config.yaml when none has been set.
+func (app *App) requiredTwoFactorRoles(ctx context.Context) ([]string, error) {
+	val, err := app.Sessions.Get(ctx, twoFactorPolicyKey)
+	if err == store.ErrNotFound {
+		return app.Config().TwoFactor.RequiredRoles, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read two-factor policy: %w", err)
+	}
+
+	var roles []string
+	if err := json.Unmarshal([]byte(val), &roles); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal two-factor policy: %w", err)
+	}
+	return roles, nil
+}
+
+// twoFactorStatus reports whether the user has enrolled a TOTP device and
+// whether their role requires one.
+func (app *App) twoFactorStatus(ctx context.Context, user *AuthData) (enrolled bool, required bool, err error) {
+	rec, err := app.loadTwoFactor(ctx, user.NIP)
+	if err != nil {
+		return false, false, err
+	}
+
+	roles, err := app.requiredTwoFactorRoles(ctx)
+	if err != nil {
+		return false, false, err
+	}
+
+	return rec != nil && rec.Enabled, hasRole(user, roles), nil
+}
+
+// writeTwoFactorChallenge parks the authenticated user in the store and tells the
+// client to continue with /auth/login/2fa (or to enroll first).
+func (app *App) writeTwoFactorChallenge(w http.ResponseWriter, r *http.Request, user *AuthData, enrolled bool) {
+	challenge := uuid.New().String()
+	pending, err := json.Marshal(pendingLogin{User: *user, Enrolled: enrolled})
+	if err != nil {
+		response.Internal(w, r, "Failed to marshal pending login", err)
+		return
+	}
+
+	err = app.Sessions.Set(r.Context(), pendingLoginKey(challenge), string(pending), app.Config().TwoFactor.ChallengeTTL)
+	if err != nil {
+		response.Internal(w, r, "Failed to store pending login", err)
+		return
+	}
+
+	message := "Two-factor code required"
+	if !enrolled {
+		message = "Two-factor enrollment required for your role"
+	}
+
+	response.OK(w, r, message, map[string]any{
+		"two_factor_required": true,
+		"enrolled":            enrolled,
+		"challenge":           challenge,
+	})
+}
+
+func (app *App) loadPendingLogin(ctx context.Context, challenge string) (*pendingLogin, error) {
+	val, err := app.Sessions.Get(ctx, pendingLoginKey(challenge))
+	if err == store.ErrNotFound {
+		return nil, fmt.Errorf("login challenge not found or expired")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get login challenge: %w", err)
+	}
+
+	var pending pendingLogin
+	if err := json.Unmarshal([]byte(val), &pending); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal login challenge: %w", err)
+	}
+	return &pending, nil
+}
+
+// savePendingLogin writes a pending login back without extending its lifetime.
+func (app *App) savePendingLogin(ctx context.Context, challenge string, pending *pendingLogin) error {
+	val, err := json.Marshal(pending)
+	if err != nil {
+		return err
+	}
+	return app.Sessions.Set(ctx, pendingLoginKey(challenge), string(val), store.KeepTTL)
+}
+
+// twoFactorSubject resolves who is managing 2FA: the user of a pending login
+// when a challenge is given, otherwise the logged-in user.
+func (app *App) twoFactorSubject(r *http.Request, challenge string) (*AuthData, error) {
+	if challenge != "" {
+		pending, err := app.loadPendingLogin(r.Context(), challenge)
+		if err != nil {
+			return nil, err
+		}
+		return &pending.User, nil
+	}
+	return app.currentAuthData(r)
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateRecoveryCodes returns fresh recovery codes and their hashes.
+func generateRecoveryCodes() (codes []string, hashes []string, err error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(raw))[:10]
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// verifySecondFactor checks a TOTP code, refusing a step that was already used,
+// or consumes a recovery code.
+func (app *App) verifySecondFactor(ctx context.Context, rec *twoFactorRecord, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		hash := hashRecoveryCode(recoveryCode)
+		for i, stored := range rec.RecoveryCodes {
+			if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+				remaining := append(rec.RecoveryCodes[:i:i], rec.RecoveryCodes[i+1:]...)
+				consumed, err := app.consumeRecoveryCode(ctx, rec, remaining)
+				if err != nil {
+					return false, fmt.Errorf("failed to consume recovery code: %w", err)
+				}
+				return consumed, nil
+			}
+		}
+		return false, nil
+	}
+
+	step, ok := matchTOTP(rec.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	// a code is only valid once, even within its time window
+	usedKey := fmt.Sprintf("totp_used:%s:%d", rec.NIP, step)
+	fresh, err := app.Sessions.SetNX(ctx, usedKey, "1", time.Duration(2*(totpSkew+1)*totpPeriod)*time.Second)
+	if err != nil {
+		return false, fmt.Errorf("failed to record TOTP use: %w", err)
+	}
+	return fresh, nil
+}
+
+// LoginTwoFactorHandler completes a login started by LoginHandler by verifying
+// the TOTP or recovery code, and only then creates the session.
+func (app *App) LoginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Challenge == "" {
+		response.Error(w, r, response.CodeInvalidRequest, "Invalid request payload")
+		return
+	}
+
+	ctx := r.Context()
+	pending, err := app.loadPendingLogin(ctx, req.Challenge)
+	if err != nil {
+		response.Error(w, r, response.CodeUnauthorized, err.Error())
+		return
+	}
+	if !app.checkLoginThrottle(w, r, pending.User.NIP) {
+		metrics.Logins.WithLabelValues("throttled").Inc()
+		return
+	}
+
+	rec, err := app.loadTwoFactor(ctx, pending.User.NIP)
+	if err != nil {
+		response.Internal(w, r, "Failed to load two-factor settings", err)
+		return
+	}
+	if rec == nil || !rec.Enabled {
+		response.Error(w, r, response.CodeTwoFactorRequired, "Two-factor enrollment required, use /auth/2fa/enroll with this challenge")
+		return
+	}
+
+	// count the attempt before verifying, so parallel guesses share the cap
+	attemptsKey := pendingLoginAttemptsKey(req.Challenge)
+	attempts, err := app.Sessions.Incr(ctx, attemptsKey)
+	if err != nil {
+		response.Internal(w, r, "Failed to count two-factor attempts", err)
+		return
+	}
+	if attempts == 1 {
+		app.Sessions.Expire(ctx, attemptsKey, app.Config().TwoFactor.ChallengeTTL)
+	}
+	if attempts > maxTwoFactorAttempts {
+		app.Sessions.Del(ctx, pendingLoginKey(req.Challenge), attemptsKey)
+		response.Error(w, r, response.CodeUnauthorized, "Too many invalid codes, log in again")
+		return
+	}
+
+	ok, err := app.verifySecondFactor(ctx, rec, req.Code, req.RecoveryCode)
+	if err != nil {
+		response.Internal(w, r, "Failed to verify two-factor code", err)
+		return
+	}
+	if !ok {
+		app.recordLoginFailures(r, pending.User.NIP)
+		metrics.Logins.WithLabelValues("invalid_code").Inc()
+		if attempts >= maxTwoFactorAttempts {
+			app.Sessions.Del(ctx, pendingLoginKey(req.Challenge), attemptsKey)
+			response.Error(w, r, response.CodeUnauthorized, "Too many invalid codes, log in again")
+			return
+		}
+		response.Error(w, r, response.CodeInvalidCode, "Invalid two-factor code")
+		return
+	}
+
+	app.Sessions.Del(ctx, pendingLoginKey(req.Challenge), attemptsKey)
+	csrf, err := app.startSession(w, r, &pending.User)
+	if err != nil {
+		response.Internal(w, r, "Failed to create session", err)
+		return
+	}
+
+	response.OK(w, r, "Login successful", map[string]any{
+		"csrf_token":          csrf,
+		"recovery_codes_left": len(rec.RecoveryCodes),
+	})
+}
+
+// EnrollTwoFactorHandler generates a new TOTP secret and returns it together
+// with its provisioning URI and a QR code PNG. The secret only becomes active
+// once confirmed through ConfirmTwoFactorHandler.
+func (app *App) EnrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, r, response.CodeInvalidRequest, "Invalid request payload")
+		return
+	}
+
+	user, err := app.twoFactorSubject(r, req.Challenge)
+	if err != nil {
+		response.Error(w, r, response.CodeUnauthorized, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	rec, err := app.loadTwoFactor(ctx, user.NIP)
+	if err != nil {
+		response.Internal(w, r, "Failed to load two-factor settings", err)
+		return
+	}
+	if rec != nil && rec.Enabled {
+		response.Error(w, r, response.CodeConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		response.Internal(w, r, "Failed to generate secret", err)
+		return
+	}
+
+	_, err = app.Database("doctracer").ExecContext(ctx, `
+		INSERT INTO user_totp (nip, secret, enabled, recovery_codes)
+		VALUES (?, ?, FALSE, '[]')
+		ON DUPLICATE KEY UPDATE secret = VALUES(secret), enabled = FALSE, recovery_codes = '[]'
+	`, user.NIP, secret)
+	if err != nil {
+		response.Internal(w, r, "Failed to store secret", err)
+		return
+	}
+
+	uri := totpURI(app.Config().TwoFactor.Issuer, user.NIP, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		response.Internal(w, r, "Failed to render QR code", err)
+		return
+	}
+
+	response.OK(w, r, "Scan the QR code, then confirm with a code from your authenticator app", map[string]any{
+		"secret":  secret,
+		"uri":     uri,
+		"qr_code": "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// ConfirmTwoFactorHandler activates a pending TOTP enrollment once the user
+// proves their device works, and returns single-use recovery codes.
+func (app *App) ConfirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, r, response.CodeInvalidRequest, "Invalid request payload")
+		return
+	}
+
+	user, err := app.twoFactorSubject(r, req.Challenge)
+	if err != nil {
+		response.Error(w, r, response.CodeUnauthorized, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	rec, err := app.loadTwoFactor(ctx, user.NIP)
+	if err != nil {
+		response.Internal(w, r, "Failed to load two-factor settings", err)
+		return
+	}
+	if rec == nil {
+		response.Error(w, r, response.CodeNotFound, "No two-factor enrollment in progress")
+		return
+	}
+	if rec.Enabled {
+		response.Error(w, r, response.CodeConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	ok, err := app.verifySecondFactor(ctx, rec, req.Code, "")
+	if err != nil {
+		response.Internal(w, r, "Failed to verify two-factor code", err)
+		return
+	}
+	if !ok {
+		response.Error(w, r, response.CodeInvalidCode, "Invalid two-factor code")
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		response.Internal(w, r, "Failed to generate recovery codes", err)
+		return
+	}
+	hashesJSON, _ := json.Marshal(hashes)
+
+	_, err = app.Database("doctracer").ExecContext(ctx, "UPDATE user_totp SET enabled = TRUE, recovery_codes = ? WHERE nip = ?", string(hashesJSON), user.NIP)
+	if err != nil {
+		response.Internal(w, r, "Failed to enable two-factor authentication", err)
+		return
+	}
+
+	// a pending login can now continue with /auth/login/2fa
+	if req.Challenge != "" {
+		if pending, err := app.loadPendingLogin(ctx, req.Challenge); err == nil {
+			pending.Enrolled = true
+			app.savePendingLogin(ctx, req.Challenge, pending)
+		}
+	}
+
+	response.OK(w, r, "Two-factor authentication enabled, store these recovery codes now", map[string]any{"recovery_codes": codes})
+}
+
+// DisableTwoFactorHandler removes the logged-in user's TOTP enrollment after
+// checking a current code, unless their role requires 2FA.
+func (app *App) DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, r, response.CodeInvalidRequest, "Invalid request payload")
+		return
+	}
+
+	user, err := app.currentAuthData(r)
+	if err != nil {
+		response.Error(w, r, response.CodeUnauthorized, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	enrolled, required, err := app.twoFactorStatus(ctx, user)
+	if err != nil {
+		response.Internal(w, r, "Failed to check two-factor status", err)
+		return
+	}
+	if required {
+		response.Error(w, r, response.CodeForbidden, "Two-factor authentication is required for your role")
+		return
+	}
+	if !enrolled {
+		response.Error(w, r, response.CodeNotFound, "Two-factor authentication is not enabled")
+		return
+	}
+
+	rec, err := app.loadTwoFactor(ctx, user.NIP)
+	if err != nil {
+		response.Internal(w, r, "Failed to load two-factor settings", err)
+		return
+	}
+	ok, err := app.verifySecondFactor(ctx, rec, req.Code, req.RecoveryCode)
+	if err != nil {
+		response.Internal(w, r, "Failed to verify two-factor code", err)
+		return
+	}
+	if !ok {
+		response.Error(w, r, response.CodeInvalidCode, "Invalid two-factor code")
+		return
+	}
+
+	if _, err := app.Database("doctracer").ExecContext(ctx, "DELETE FROM user_totp WHERE nip = ?", user.NIP); err != nil {
+		response.Internal(w, r, "Failed to disable two-factor authentication", err)
+		return
+	}
+
+	response.OK(w, r, "Two-factor authentication disabled", nil)
+}
+
+// GetTwoFactorPolicyHandler returns the roles currently required to use 2FA.
+func (app *App) GetTwoFactorPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.requiredTwoFactorRoles(r.Context())
+	if err != nil {
+		response.Internal(w, r, "Failed to read two-factor policy", err)
+		return
+	}
+	if roles == nil {
+		roles = []string{}
+	}
+
+	response.OK(w, r, "", TwoFactorPolicy{RequiredRoles: roles})
+}
+
+// UpdateTwoFactorPolicyHandler lets a supervisor change which roles must use
+// 2FA without editing config.yaml.
+func (app *App) UpdateTwoFactorPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	var policy TwoFactorPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		response.Error(w, r, response.CodeInvalidRequest, "Invalid request payload")
+		return
+	}
+	if policy.RequiredRoles == nil {
+		policy.RequiredRoles = []string{}
+	}
+	// an unknown role would silently leave the intended one without 2FA
+	for _, role := range policy.RequiredRoles {
+		if !isValidRole(role) {
+			response.Error(w, r, response.CodeInvalidRequest, fmt.Sprintf("Invalid role %q, must be one of %s", role, strings.Join(validRoles, ", ")))
+			return
+		}
+	}
+
+	roles, err := json.Marshal(policy.RequiredRoles)
+	if err != nil {
+		response.Internal(w, r, "Failed to marshal policy", err)
+		return
+	}
+	if err := app.Sessions.Set(r.Context(), twoFactorPolicyKey, string(roles), 0); err != nil {
+		response.Internal(w, r, "Failed to store policy", err)
+		return
+	}
+
+	logging.From(r.Context()).Info("two-factor policy changed", "required_roles", policy.RequiredRoles)
+
+	response.OK(w, r, "", policy)
+}
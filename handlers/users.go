@@ -0,0 +1,390 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"watcher/logging"
+	"watcher/response"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// minPasswordLength is the shortest password accepted when creating or resetting.
+const minPasswordLength = 8
+
+// maxPasswordBytes is the longest password bcrypt can hash.
+const maxPasswordBytes = 72
+
+// User is a row of the doctracer users table, without its password.
+type User struct {
+	UserID       string    `json:"user_id"`
+	NIP          string    `json:"nip"`
+	Name         string    `json:"name"`
+	Role         string    `json:"role"`
+	Jabatan      string    `json:"jabatan"`
+	DepartmentID string    `json:"department_id"`
+	Active       bool      `json:"active"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// CreateUserRequest is the payload of POST /users.
+type CreateUserRequest struct {
+	NIP          string `json:"nip"`
+	Name         string `json:"name"`
+	Password     string `json:"password"`
+	Role         string `json:"role"`
+	Jabatan      string `json:"jabatan"`
+	DepartmentID string `json:"department_id"`
+}
+
+// UpdateUserRequest is the payload of PUT /users/{userId}. Empty fields are left unchanged.
+type UpdateUserRequest struct {
+	Name         string `json:"name"`
+	Jabatan      string `json:"jabatan"`
+	DepartmentID string `json:"department_id"`
+}
+
+// UpdateRoleRequest is the payload of PUT /users/{userId}/role.
+type UpdateRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// ResetPasswordRequest is the payload of POST /users/{userId}/password.
+type ResetPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+var validRoles = []string{RoleContributor, RoleReviewer, RoleSupervisor}
+
+func isValidRole(role string) bool {
+	for _, r := range validRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// passwordProblem describes why a new password is not accepted, or returns
+// "" if it is.
+func passwordProblem(password string) string {
+	if len(password) < minPasswordLength {
+		return fmt.Sprintf("Password must be at least %d characters", minPasswordLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Sprintf("Password must be at most %d bytes", maxPasswordBytes)
+	}
+	return ""
+}
+
+const userColumns = "user_id, nip, name, role, jabatan, department_id, active, created_at, updated_at"
+
+func scanUser(row interface{ Scan(...any) error }) (*User, error) {
+	var user User
+	err := row.Scan(&user.UserID, &user.NIP, &user.Name, &user.Role, &user.Jabatan, &user.DepartmentID, &user.Active, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// userDeactivated reports whether nip has a row in the users table that was
+// deactivated. Directory users without a local row are not deactivated.
+func (app *App) userDeactivated(ctx context.Context, nip string) (bool, error) {
+	db := app.Database("doctracer")
+	if db == nil {
+		return false, fmt.Errorf("database 'doctracer' is not connected")
+	}
+
+	var active bool
+	err := db.QueryRowContext(ctx, "SELECT active FROM users WHERE nip = ?", nip).Scan(&active)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check user status: %w", err)
+	}
+	return !active, nil
+}
+
+// findUser loads a user by ID, writing a 404 or 500 response when it cannot.
+func (app *App) findUser(w http.ResponseWriter, r *http.Request, userID string) (*User, bool) {
+	row := app.Database("doctracer").QueryRowContext(r.Context(), "SELECT "+userColumns+" FROM users WHERE user_id = ?", userID)
+	user, err := scanUser(row)
+	if err == sql.ErrNoRows {
+		response.Error(w, r, response.CodeNotFound, "User not found")
+		return nil, false
+	}
+	if err != nil {
+		response.Internal(w, r, "Database error", err)
+		return nil, false
+	}
+	return user, true
+}
+
+// writeUser responds with a user re-read from the database.
+func (app *App) writeUser(w http.ResponseWriter, r *http.Request, userID string, status int) {
+	user, ok := app.findUser(w, r, userID)
+	if !ok {
+		return
+	}
+
+	response.JSON(w, r, status, "", user)
+}
+
+// logUserChange records who changed which user.
+func logUserChange(r *http.Request, action string, user *User) {
+	logging.From(r.Context()).Info("user "+action, "user_id", user.UserID, "nip", user.NIP)
+}
+
+// ListUsersHandler lists all users. ?active=true|false filters by status.
+func (app *App) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	query := "SELECT " + userColumns + " FROM users"
+	switch r.URL.Query().Get("active") {
+	case "true":
+		query += " WHERE active = TRUE"
+	case "false":
+		query += " WHERE active = FALSE"
+	}
+	query += " ORDER BY name"
+
+	rows, err := app.Database("doctracer").QueryContext(r.Context(), query)
+	if err != nil {
+		response.Internal(w, r, "Database error", err)
+		return
+	}
+	defer rows.Close()
+
+	users := make([]User, 0)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			response.Internal(w, r, "Database error", err)
+			return
+		}
+		users = append(users, *user)
+	}
+	if err := rows.Err(); err != nil {
+		response.Internal(w, r, "Database error", err)
+		return
+	}
+
+	response.OK(w, r, "", users)
+}
+
+// GetUserHandler returns a single user.
+func (app *App) GetUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeUser(w, r, mux.Vars(r)["userId"], http.StatusOK)
+}
+
+// CreateUserHandler adds a user with a hashed password.
+func (app *App) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, r, response.CodeInvalidRequest, "Invalid request payload")
+		return
+	}
+
+	req.NIP = strings.TrimSpace(req.NIP)
+	req.Name = strings.TrimSpace(req.Name)
+	req.Jabatan = strings.TrimSpace(req.Jabatan)
+	req.DepartmentID = strings.TrimSpace(req.DepartmentID)
+	if req.NIP == "" || req.Name == "" {
+		response.Error(w, r, response.CodeInvalidRequest, "NIP and name are required")
+		return
+	}
+	if req.Role == "" {
+		req.Role = RoleContributor
+	}
+	if !isValidRole(req.Role) {
+		response.Error(w, r, response.CodeInvalidRequest, fmt.Sprintf("Invalid role, must be one of %s", strings.Join(validRoles, ", ")))
+		return
+	}
+	if msg := passwordProblem(req.Password); msg != "" {
+		response.Error(w, r, response.CodeInvalidRequest, msg)
+		return
+	}
+
+	hash, err := HashPassword(req.Password)
+	if err != nil {
+		response.Internal(w, r, "Failed to hash password", err)
+		return
+	}
+
+	userID := uuid.New().String()
+	_, err = app.Database("doctracer").ExecContext(r.Context(), `
+		INSERT INTO users (user_id, nip, name, password, role, jabatan, department_id, active)
+		VALUES (?, ?, ?, ?, ?, ?, ?, TRUE)
+	`, userID, req.NIP, req.Name, hash, req.Role, req.Jabatan, req.DepartmentID)
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 { // duplicate entry
+		response.Error(w, r, response.CodeConflict, "A user with this NIP already exists")
+		return
+	}
+	if err != nil {
+		response.Internal(w, r, "Failed to create user", err)
+		return
+	}
+
+	logUserChange(r, "created", &User{UserID: userID, NIP: req.NIP})
+	app.writeUser(w, r, userID, http.StatusCreated)
+}
+
+// UpdateUserHandler changes a user's name, jabatan or department. Sessions and
+// API tokens carry the old jabatan and department, so they are revoked when
+// either changes.
+func (app *App) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var req UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, r, response.CodeInvalidRequest, "Invalid request payload")
+		return
+	}
+
+	user, ok := app.findUser(w, r, mux.Vars(r)["userId"])
+	if !ok {
+		return
+	}
+
+	// blank fields are left unchanged
+	oldJabatan, oldDepartmentID := user.Jabatan, user.DepartmentID
+	if name := strings.TrimSpace(req.Name); name != "" {
+		user.Name = name
+	}
+	if jabatan := strings.TrimSpace(req.Jabatan); jabatan != "" {
+		user.Jabatan = jabatan
+	}
+	if departmentID := strings.TrimSpace(req.DepartmentID); departmentID != "" {
+		user.DepartmentID = departmentID
+	}
+
+	_, err := app.Database("doctracer").ExecContext(r.Context(),
+		"UPDATE users SET name = ?, jabatan = ?, department_id = ? WHERE user_id = ?",
+		user.Name, user.Jabatan, user.DepartmentID, user.UserID)
+	if err != nil {
+		response.Internal(w, r, "Failed to update user", err)
+		return
+	}
+	if user.Jabatan != oldJabatan || user.DepartmentID != oldDepartmentID {
+		app.revokeUserAccess(r.Context(), user.NIP)
+	}
+
+	logUserChange(r, fmt.Sprintf("updated (jabatan %q, department %q)", user.Jabatan, user.DepartmentID), user)
+	app.writeUser(w, r, user.UserID, http.StatusOK)
+}
+
+// UpdateUserRoleHandler assigns the contributor, reviewer or supervisor role.
+// Existing sessions keep their old role until the user logs in again, so they
+// are revoked.
+func (app *App) UpdateUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var req UpdateRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, r, response.CodeInvalidRequest, "Invalid request payload")
+		return
+	}
+	if !isValidRole(req.Role) {
+		response.Error(w, r, response.CodeInvalidRequest, fmt.Sprintf("Invalid role, must be one of %s", strings.Join(validRoles, ", ")))
+		return
+	}
+
+	user, ok := app.findUser(w, r, mux.Vars(r)["userId"])
+	if !ok {
+		return
+	}
+
+	_, err := app.Database("doctracer").ExecContext(r.Context(), "UPDATE users SET role = ? WHERE user_id = ?", req.Role, user.UserID)
+	if err != nil {
+		response.Internal(w, r, "Failed to update role", err)
+		return
+	}
+	app.revokeUserAccess(r.Context(), user.NIP)
+
+	logUserChange(r, fmt.Sprintf("role %s -> %s", user.Role, req.Role), user)
+	app.writeUser(w, r, user.UserID, http.StatusOK)
+}
+
+// ResetUserPasswordHandler sets a new password and ends the user's sessions.
+func (app *App) ResetUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, r, response.CodeInvalidRequest, "Invalid request payload")
+		return
+	}
+	if msg := passwordProblem(req.Password); msg != "" {
+		response.Error(w, r, response.CodeInvalidRequest, msg)
+		return
+	}
+
+	user, ok := app.findUser(w, r, mux.Vars(r)["userId"])
+	if !ok {
+		return
+	}
+
+	hash, err := HashPassword(req.Password)
+	if err != nil {
+		response.Internal(w, r, "Failed to hash password", err)
+		return
+	}
+
+	_, err = app.Database("doctracer").ExecContext(r.Context(), "UPDATE users SET password = ? WHERE user_id = ?", hash, user.UserID)
+	if err != nil {
+		response.Internal(w, r, "Failed to reset password", err)
+		return
+	}
+	app.revokeUserAccess(r.Context(), user.NIP)
+
+	logUserChange(r, "password reset", user)
+	app.writeUser(w, r, user.UserID, http.StatusOK)
+}
+
+// DeactivateUserHandler disables login for a user and revokes their sessions
+// and API tokens.
+func (app *App) DeactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.setUserActive(w, r, false)
+}
+
+// ActivateUserHandler re-enables login for a deactivated user.
+func (app *App) ActivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.setUserActive(w, r, true)
+}
+
+func (app *App) setUserActive(w http.ResponseWriter, r *http.Request, active bool) {
+	user, ok := app.findUser(w, r, mux.Vars(r)["userId"])
+	if !ok {
+		return
+	}
+
+	_, err := app.Database("doctracer").ExecContext(r.Context(), "UPDATE users SET active = ? WHERE user_id = ?", active, user.UserID)
+	if err != nil {
+		response.Internal(w, r, "Failed to update user", err)
+		return
+	}
+
+	action := "activated"
+	if !active {
+		action = "deactivated"
+		app.revokeUserAccess(r.Context(), user.NIP)
+	}
+
+	logUserChange(r, action, user)
+	app.writeUser(w, r, user.UserID, http.StatusOK)
+}
+
+// revokeUserAccess ends every session and API token of a NIP.
+func (app *App) revokeUserAccess(ctx context.Context, nip string) {
+	if _, err := app.revokeUserSessions(ctx, nip); err != nil {
+		logging.From(ctx).Error("failed to revoke sessions", "nip", nip, "error", err)
+	}
+	if _, err := app.revokeUserAPITokens(ctx, nip); err != nil {
+		logging.From(ctx).Error("failed to revoke API tokens", "nip", nip, "error", err)
+	}
+}
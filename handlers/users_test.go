@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateAndUpdateUserTrimFields(t *testing.T) {
+	var stored []driver.Value // arguments of the last INSERT or UPDATE
+	db := &fakeDB{
+		query: func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+			if !strings.Contains(query, "FROM users WHERE user_id = ?") {
+				return nil, nil, errors.New("unexpected query: " + query)
+			}
+			columns := strings.Split(userColumns, ", ")
+			now := time.Now()
+			return columns, [][]driver.Value{{"u2", testTargetNIP, "Target User", RoleReviewer, "Pelaksana", "D01", true, now, now}}, nil
+		},
+		exec: func(query string, args []driver.NamedValue) (int64, error) {
+			stored = nil
+			for _, arg := range args {
+				stored = append(stored, arg.Value)
+			}
+			return 1, nil
+		},
+	}
+	app := newTestApp(t, db)
+	srv := httptest.NewServer(app.Handler())
+	defer srv.Close()
+	cookie, csrf := newTestSession(t, app, testSupervisor())
+
+	status, env := doJSON(t, http.DefaultClient, "POST", srv.URL+"/users", CreateUserRequest{
+		NIP: " " + testTargetNIP, Name: "Target User ", Password: "long-enough-password",
+		Jabatan: " Pelaksana\t", DepartmentID: " D01 ",
+	}, sessionHeader(cookie, csrf))
+	if status != http.StatusCreated {
+		t.Fatalf("create user = %d %q, want 201", status, env.Code)
+	}
+	// user_id, nip, name, password, role, jabatan, department_id
+	if len(stored) != 7 || stored[1] != testTargetNIP || stored[2] != "Target User" || stored[5] != "Pelaksana" || stored[6] != "D01" {
+		t.Errorf("INSERT arguments = %q, want trimmed nip, name, jabatan and department_id", stored)
+	}
+
+	status, env = doJSON(t, http.DefaultClient, "PUT", srv.URL+"/users/u2", UpdateUserRequest{
+		Name: "  ", Jabatan: "Pelaksana ", DepartmentID: " D02",
+	}, sessionHeader(cookie, csrf))
+	if status != http.StatusOK {
+		t.Fatalf("update user = %d %q, want 200", status, env.Code)
+	}
+	// name, jabatan, department_id, user_id
+	if want := []driver.Value{"Target User", "Pelaksana", "D02", "u2"}; !reflect.DeepEqual(stored, want) {
+		t.Errorf("UPDATE arguments = %q, want %q", stored, want)
+	}
+}
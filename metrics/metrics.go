@@ -0,0 +1,87 @@
+// Package metrics defines the Prometheus metrics of the server. They are
+// registered with the default registry, which also carries the Go runtime
+// and process metrics, and served by Handler.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// HTTPRequests counts requests by mux route template ("unmatched" for
+	// 404/405), method and status code.
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gofs_http_requests_total",
+		Help: "HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gofs_http_request_duration_seconds",
+		Help:    "HTTP request latency by route template and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	// GhostscriptDuration covers successful and failed runs; compressing a
+	// scanned document can take minutes.
+	GhostscriptDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gofs_ghostscript_duration_seconds",
+		Help:    "Ghostscript PDF compression run time by compression level.",
+		Buckets: prometheus.ExponentialBuckets(0.25, 2, 11), // 0.25s to 256s
+	}, []string{"level"})
+
+	GhostscriptFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gofs_ghostscript_failures_total",
+		Help: "Failed Ghostscript PDF compressions by compression level.",
+	}, []string{"level"})
+
+	CronRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gofs_cron_runs_total",
+		Help: "Cron job runs by job and result (success or failure).",
+	}, []string{"job", "result"})
+
+	CronDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gofs_cron_duration_seconds",
+		Help:    "Cron job run time by job.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"job"})
+
+	CronLastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gofs_cron_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful run by job.",
+	}, []string{"job"})
+
+	// Logins counts login attempts by result: success (a session was
+	// created), invalid_credentials, invalid_code (second factor), throttled
+	// or error.
+	Logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gofs_logins_total",
+		Help: "Login attempts by result.",
+	}, []string{"result"})
+)
+
+var handler = promhttp.Handler()
+
+// Handler serves the metrics of the default registry in the Prometheus text format.
+func Handler() http.Handler {
+	return handler
+}
+
+// CronJob wraps a cron job so every run is counted and timed.
+func CronJob(name string, job func() error) func() {
+	return func() {
+		start := time.Now()
+		err := job()
+		CronDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+		if err != nil {
+			CronRuns.WithLabelValues(name, "failure").Inc()
+			return
+		}
+		CronRuns.WithLabelValues(name, "success").Inc()
+		CronLastSuccess.WithLabelValues(name).SetToCurrentTime()
+	}
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"watcher/config"
+	"watcher/store"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	mysqlMaxOpen = prometheus.NewDesc("gofs_mysql_max_open_connections",
+		"Maximum number of open connections of the MySQL pool.", []string{"database"}, nil)
+	mysqlConnections = prometheus.NewDesc("gofs_mysql_connections",
+		"Open MySQL connections by state (in_use or idle).", []string{"database", "state"}, nil)
+	mysqlWaits = prometheus.NewDesc("gofs_mysql_waits_total",
+		"Times a query waited for a free MySQL connection.", []string{"database"}, nil)
+	mysqlWaitSeconds = prometheus.NewDesc("gofs_mysql_wait_seconds_total",
+		"Time spent waiting for a free MySQL connection.", []string{"database"}, nil)
+	mysqlClosed = prometheus.NewDesc("gofs_mysql_closed_connections_total",
+		"MySQL connections closed by the pool by reason (max_idle, max_idle_time or max_lifetime).", []string{"database", "reason"}, nil)
+
+	redisConnections = prometheus.NewDesc("gofs_redis_pool_connections",
+		"Redis pool connections by state (total, idle or stale).", []string{"state"}, nil)
+	redisRequests = prometheus.NewDesc("gofs_redis_pool_requests_total",
+		"Redis pool connection requests by result (hit, miss or timeout).", []string{"result"}, nil)
+)
+
+// poolCollector reads the pool statistics of the current clients on every
+// scrape, so clients replaced by a config reload are picked up. Counters
+// start over when a client is replaced.
+type poolCollector struct {
+	services *config.Services
+}
+
+// NewPoolCollector returns a collector for the MySQL pools and the Redis
+// session store of services. Register it once with prometheus.MustRegister.
+func NewPoolCollector(services *config.Services) prometheus.Collector {
+	return &poolCollector{services: services}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{mysqlMaxOpen, mysqlConnections, mysqlWaits, mysqlWaitSeconds, mysqlClosed, redisConnections, redisRequests} {
+		ch <- desc
+	}
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, db := range c.services.Databases() {
+		stats := db.Stats()
+		ch <- prometheus.MustNewConstMetric(mysqlMaxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections), name)
+		ch <- prometheus.MustNewConstMetric(mysqlConnections, prometheus.GaugeValue, float64(stats.InUse), name, "in_use")
+		ch <- prometheus.MustNewConstMetric(mysqlConnections, prometheus.GaugeValue, float64(stats.Idle), name, "idle")
+		ch <- prometheus.MustNewConstMetric(mysqlWaits, prometheus.CounterValue, float64(stats.WaitCount), name)
+		ch <- prometheus.MustNewConstMetric(mysqlWaitSeconds, prometheus.CounterValue, stats.WaitDuration.Seconds(), name)
+		ch <- prometheus.MustNewConstMetric(mysqlClosed, prometheus.CounterValue, float64(stats.MaxIdleClosed), name, "max_idle")
+		ch <- prometheus.MustNewConstMetric(mysqlClosed, prometheus.CounterValue, float64(stats.MaxIdleTimeClosed), name, "max_idle_time")
+		ch <- prometheus.MustNewConstMetric(mysqlClosed, prometheus.CounterValue, float64(stats.MaxLifetimeClosed), name, "max_lifetime")
+	}
+
+	// the in-memory store has no pool
+	redisStore, ok := c.services.Sessions.Current().(*store.RedisStore)
+	if !ok {
+		return
+	}
+	stats := redisStore.Client().PoolStats()
+	ch <- prometheus.MustNewConstMetric(redisConnections, prometheus.GaugeValue, float64(stats.TotalConns), "total")
+	ch <- prometheus.MustNewConstMetric(redisConnections, prometheus.GaugeValue, float64(stats.IdleConns), "idle")
+	ch <- prometheus.MustNewConstMetric(redisConnections, prometheus.GaugeValue, float64(stats.StaleConns), "stale")
+	ch <- prometheus.MustNewConstMetric(redisRequests, prometheus.CounterValue, float64(stats.Hits), "hit")
+	ch <- prometheus.MustNewConstMetric(redisRequests, prometheus.CounterValue, float64(stats.Misses), "miss")
+	ch <- prometheus.MustNewConstMetric(redisRequests, prometheus.CounterValue, float64(stats.Timeouts), "timeout")
+}
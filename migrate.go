@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"watcher/config"
+	"watcher/migrations"
+)
+
+const migrateUsage = `usage: gofs [--config path] migrate <command>
+
+  up [database...]          apply pending migrations (all databases by default)
+  down <database> [steps]   revert the last applied migrations (default 1)
+  status [database...]      list migrations and when they were applied`
+
+// runMigrate handles the migrate subcommand and returns the exit code. Results
+// go to stdout, usage and errors to stderr.
+func runMigrate(services *config.Services, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	// connect without applying anything, the command decides what to run
+	cfg := *services.Config()
+	cfg.Migrations.OnStart = "none"
+	services.SetConfig(&cfg)
+	if err := services.InitMySQL(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing MySQL: %s\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	lockTimeout := cfg.Migrations.LockTimeout
+	command, args := args[0], args[1:]
+	switch command {
+	case "up":
+		for _, name := range migrateTargets(&cfg, args) {
+			db := services.Database(name)
+			if db == nil {
+				fmt.Fprintf(os.Stderr, "Error: database '%s' is not connected\n", name)
+				return 1
+			}
+			applied, err := migrations.Up(ctx, db, name, lockTimeout)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				return 1
+			}
+			fmt.Printf("%s: %d migration(s) applied\n", name, applied)
+		}
+
+	case "down":
+		if len(args) == 0 || len(args) > 2 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		steps := 1
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintf(os.Stderr, "Error: steps must be a positive number, got %q\n", args[1])
+				return 2
+			}
+			steps = n
+		}
+		db := services.Database(args[0])
+		if db == nil {
+			fmt.Fprintf(os.Stderr, "Error: database '%s' is not connected\n", args[0])
+			return 1
+		}
+		reverted, err := migrations.Down(ctx, db, args[0], steps, lockTimeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return 1
+		}
+		fmt.Printf("%s: %d migration(s) reverted\n", args[0], reverted)
+
+	case "status":
+		for _, name := range migrateTargets(&cfg, args) {
+			db := services.Database(name)
+			if db == nil {
+				fmt.Printf("%s: not connected\n", name)
+				continue
+			}
+			statuses, err := migrations.List(ctx, db, name)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				return 1
+			}
+			fmt.Printf("%s:\n", name)
+			for _, s := range statuses {
+				applied := "pending"
+				if !s.AppliedAt.IsZero() {
+					applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+				}
+				fmt.Printf("  %04d_%s  %s\n", s.Version, s.Name, applied)
+			}
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
+
+// migrateTargets returns the named databases, or every configured one.
+func migrateTargets(cfg *config.Config, names []string) []string {
+	if len(names) > 0 {
+		return names
+	}
+	for name := range cfg.MySQL {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
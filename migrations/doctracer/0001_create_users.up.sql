@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS users (
+    user_id VARCHAR(36) NOT NULL PRIMARY KEY,
+    nip VARCHAR(32) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    role VARCHAR(32) NOT NULL,
+    jabatan VARCHAR(255) NOT NULL DEFAULT '',
+    department_id VARCHAR(64) NOT NULL DEFAULT '',
+    UNIQUE KEY (nip)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS impersonation_audit (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    supervisor_nip VARCHAR(32) NOT NULL,
+    target_nip VARCHAR(32) NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    detail VARCHAR(500) NOT NULL DEFAULT '',
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY (supervisor_nip),
+    KEY (target_nip)
+);
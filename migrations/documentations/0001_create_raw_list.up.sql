@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS raw_list (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    file_name VARCHAR(255) NOT NULL,
+    file_path VARCHAR(255) NOT NULL,
+    last_updated TIMESTAMP NOT NULL,
+    UNIQUE KEY (file_path)
+);
@@ -0,0 +1,50 @@
+-- masterfile is filled from the mfwp CSV export, see sql/mfwp.txt
+CREATE TABLE IF NOT EXISTS masterfile (
+    TANGGAL_DAFTAR     DATE,
+    TANGGAL_PINDAH     DATE,
+    TANGGAL_LAHIR      DATE,
+    NPWP               VARCHAR(15),
+    KD_KPP             VARCHAR(10),
+    KD_CABANG          VARCHAR(10),
+    PUSAT_CABANG       VARCHAR(10),
+    NPWP_15            VARCHAR(15),
+    NAMA_WP            VARCHAR(255),
+    ALAMAT             VARCHAR(500),
+    KOTA               VARCHAR(100),
+    KODE_POS           VARCHAR(10),
+    NOMOR_TELEPON      VARCHAR(25),
+    NOMOR_FAX          VARCHAR(25),
+    EMAIL              VARCHAR(255),
+    NOMOR_IDENTITAS    VARCHAR(50),
+    STATUS_WP          VARCHAR(50),
+    JENIS_WP           VARCHAR(50),
+    KODE_KLU           VARCHAR(15),
+    NAMA_KLU           VARCHAR(255),
+    SEKTOR             VARCHAR(100),
+    TANGGAL_PKP        DATE,
+    KELURAHAN          VARCHAR(100),
+    KECAMATAN          VARCHAR(100),
+    PROPINSI           VARCHAR(100),
+    BENTUK_HUKUM       VARCHAR(100),
+    MATA_UANG          VARCHAR(3),
+    NO_SKT             VARCHAR(50),
+    NO_PKP             VARCHAR(50),
+    NO_PKP_CABUT       VARCHAR(50),
+    TGL_PKP_CABUT      DATE,
+    METODE_PERHITUNGAN VARCHAR(100),
+    NIP_AR             CHAR(18),
+    NAMA_AR            VARCHAR(255),
+    SEKSI              VARCHAR(100),
+    NIP_JS             VARCHAR(18),
+    NAMA_JS            VARCHAR(255),
+    NIP_EKS            VARCHAR(18),
+    NAMA_EKS           VARCHAR(255),
+    JNS_BADAN_HUKUM    VARCHAR(100),
+    STATUS_MODAL       VARCHAR(100),
+    KATEGORI           VARCHAR(100),
+    ID_BL_BUKU_AWAL    YEAR,
+    ID_BL_BUKU_AKHIR   YEAR,
+    NPWP16             VARCHAR(16),
+    STS_16             VARCHAR(20),
+    TGL_UPDATE16       DATETIME
+);
@@ -0,0 +1,306 @@
+// Package migrations holds the versioned schema of every MySQL database and
+// applies it. Files live in <database>/<version>_<name>.up.sql and
+// <version>_<name>.down.sql, where <database> is the key of the entry under
+// mysql in config.yaml. Applied versions are recorded in schema_migrations.
+// A migration without a down file cannot be reverted, e.g. because its up
+// file skips changes the schema already had and so cannot tell them apart.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed */*.sql
+var files embed.FS
+
+var filePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one schema change of a database.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and when it was applied, zero if it is pending.
+type Status struct {
+	Migration
+	AppliedAt time.Time
+}
+
+// Load returns the migrations of a database ordered by version. A database
+// without a migrations directory has none.
+func Load(database string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, database)
+	if err != nil {
+		return nil, nil
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := filePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration %s/%s: name must be <version>_<name>.up.sql or .down.sql", database, entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		body, err := files.ReadFile(path.Join(database, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %s/%d: conflicting names %s and %s", database, version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %s/%d_%s has no up file", database, m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up applies every pending migration of the database in version order and
+// returns how many were applied.
+func Up(ctx context.Context, db *sql.DB, database string, lockTimeout time.Duration) (int, error) {
+	migrations, err := Load(database)
+	if err != nil || len(migrations) == 0 {
+		return 0, err
+	}
+
+	applied := 0
+	err = withLock(ctx, db, database, lockTimeout, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if _, ok := done[m.Version]; ok {
+				continue
+			}
+			if err := run(ctx, conn, m.Up); err != nil {
+				return fmt.Errorf("migration %s/%d_%s up: %w", database, m.Version, m.Name, err)
+			}
+			_, err := conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name)
+			if err != nil {
+				return fmt.Errorf("failed to record migration %s/%d: %w", database, m.Version, err)
+			}
+			slog.Info("applied migration", "database", database, "version", m.Version, "name", m.Name)
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the last steps applied migrations of the database, newest first,
+// and returns how many were reverted.
+func Down(ctx context.Context, db *sql.DB, database string, steps int, lockTimeout time.Duration) (int, error) {
+	migrations, err := Load(database)
+	if err != nil || len(migrations) == 0 {
+		return 0, err
+	}
+
+	reverted := 0
+	err = withLock(ctx, db, database, lockTimeout, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && reverted < steps; i-- {
+			m := migrations[i]
+			if _, ok := done[m.Version]; !ok {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("migration %s/%d_%s has no down file and cannot be reverted", database, m.Version, m.Name)
+			}
+			if err := run(ctx, conn, m.Down); err != nil {
+				return fmt.Errorf("migration %s/%d_%s down: %w", database, m.Version, m.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", m.Version); err != nil {
+				return fmt.Errorf("failed to unrecord migration %s/%d: %w", database, m.Version, err)
+			}
+			slog.Info("reverted migration", "database", database, "version", m.Version, "name", m.Name)
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// List returns every migration of the database with the time it was applied.
+func List(ctx context.Context, db *sql.DB, database string) ([]Status, error) {
+	migrations, err := Load(database)
+	if err != nil || len(migrations) == 0 {
+		return nil, err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	done, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, len(migrations))
+	for i, m := range migrations {
+		statuses[i] = Status{Migration: m, AppliedAt: done[m.Version]}
+	}
+	return statuses, nil
+}
+
+// withLock runs fn on a single connection holding a named MySQL lock, so
+// servers starting side by side do not apply the same migration twice.
+func withLock(ctx context.Context, db *sql.DB, database string, timeout time.Duration, fn func(conn *sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	lockName := "gofs_migrations:" + database
+	var locked sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, int(timeout.Seconds())).Scan(&locked)
+	if err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return fmt.Errorf("timed out after %s waiting for the migration lock of %s", timeout, database)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName)
+
+	return fn(conn)
+}
+
+// appliedVersions creates schema_migrations if needed and returns the applied
+// versions with the time they were applied.
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	_, err := conn.ExecContext(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	done := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		done[version] = appliedAt
+	}
+	return done, rows.Err()
+}
+
+// run executes the statements of a migration file one by one on conn, so
+// session variables and prepared statements carry over between them. MySQL
+// commits DDL implicitly, so a failing file is not rolled back.
+func run(ctx context.Context, conn *sql.Conn, script string) error {
+	for _, stmt := range splitStatements(script) {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitStatements splits a script on the semicolons that end its statements.
+// Semicolons in quoted strings, quoted identifiers and /* */ comments do not
+// end a statement; "--" and "#" comments are dropped.
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	flush := func() {
+		if stmt := strings.TrimSpace(current.String()); stmt != "" {
+			statements = append(statements, stmt)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// copy the quoted text; backslashes escape in strings, a
+			// doubled quote is read as two adjacent quoted texts
+			end := i + 1
+			for end < len(script) && script[end] != c {
+				if script[end] == '\\' && c != '`' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(script))
+			current.WriteString(script[i:end])
+			i = end - 1
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				end = len(script)
+			} else {
+				end += i + 4
+			}
+			current.WriteString(script[i:end])
+			i = end - 1
+		case c == '#' || isDashComment(script[i:]):
+			// skip to the newline, which is kept
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+			i += end - 1
+		case c == ';':
+			flush()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	flush()
+	return statements
+}
+
+// isDashComment reports whether s starts with a "--" comment, which MySQL
+// requires to be followed by whitespace or the end of the line.
+func isDashComment(s string) bool {
+	return strings.HasPrefix(s, "--") && (len(s) == 2 || strings.ContainsRune(" \t\r\n", rune(s[2])))
+}
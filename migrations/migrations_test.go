@@ -0,0 +1,66 @@
+package migrations
+
+import (
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"one per line", "CREATE TABLE a (id INT);\nDROP TABLE b;\n", []string{"CREATE TABLE a (id INT)", "DROP TABLE b"}},
+		{"several on a line", "SET @a = 1; SET @b = 2;", []string{"SET @a = 1", "SET @b = 2"}},
+		{"spanning lines", "ALTER TABLE a\n    ADD COLUMN b INT;\n", []string{"ALTER TABLE a\n    ADD COLUMN b INT"}},
+		{"last without semicolon", "DO 0;\nDO 1", []string{"DO 0", "DO 1"}},
+		{"only comments", "-- nothing here\n\n# nor here\n", nil},
+		{"dash comment lines", "-- first\nDO 0;\n  -- second\nDO 1;", []string{"DO 0", "DO 1"}},
+		{"dash comment after a statement", "DO 0; -- the first\nDO 1; -- the second", []string{"DO 0", "DO 1"}},
+		{"hash comment after a statement", "DO 0; # the first; really\nDO 1;", []string{"DO 0", "DO 1"}},
+		{"double dash without space is an operator", "SELECT 1--1;", []string{"SELECT 1--1"}},
+		{"semicolon in a string", "INSERT INTO a VALUES ('x;y');", []string{"INSERT INTO a VALUES ('x;y')"}},
+		{"semicolon ending a line in a string", "INSERT INTO a VALUES ('x;\ny');", []string{"INSERT INTO a VALUES ('x;\ny')"}},
+		{"comment markers in a string", "SELECT '-- not # a comment';", []string{"SELECT '-- not # a comment'"}},
+		{"escaped quote", `SELECT 'it\'s; fine';`, []string{`SELECT 'it\'s; fine'`}},
+		{"doubled quote", "SELECT 'it''s; fine';", []string{"SELECT 'it''s; fine'"}},
+		{"double-quoted string", `SET @stmt = "DO 1; DO 2";`, []string{`SET @stmt = "DO 1; DO 2"`}},
+		{"quoted identifier", "CREATE TABLE `a;b` (id INT);", []string{"CREATE TABLE `a;b` (id INT)"}},
+		{"block comment", "DO /* one; two */ 0;", []string{"DO /* one; two */ 0"}},
+		{"unterminated string", "SELECT 'x;", []string{"SELECT 'x;"}},
+	}
+	for _, tt := range tests {
+		if got := splitStatements(tt.script); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: splitStatements(%q) = %q, want %q", tt.name, tt.script, got, tt.want)
+		}
+	}
+}
+
+// TestEmbeddedMigrations loads the migrations of every database and checks
+// that each file splits into statements.
+func TestEmbeddedMigrations(t *testing.T) {
+	databases, err := fs.ReadDir(files, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, database := range databases {
+		migrations, err := Load(database.Name())
+		if err != nil {
+			t.Errorf("%s: %v", database.Name(), err)
+			continue
+		}
+		for i, m := range migrations {
+			if m.Version != i+1 {
+				t.Errorf("%s/%d_%s: versions must count up from 1 without gaps", database.Name(), m.Version, m.Name)
+			}
+			if len(splitStatements(m.Up)) == 0 {
+				t.Errorf("%s/%d_%s: up file has no statements", database.Name(), m.Version, m.Name)
+			}
+			if m.Down != "" && len(splitStatements(m.Down)) == 0 {
+				t.Errorf("%s/%d_%s: down file has no statements", database.Name(), m.Version, m.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"watcher/config"
+	"watcher/handlers"
+	"watcher/logging"
+)
+
+// handleReloads reloads the configuration on SIGHUP and, if reload.watch is
+// set, whenever the file changes. The returned function stops both.
+func handleReloads(app *handlers.App, configPath string) func() {
+	hup := make(chan os.Signal, 1)
+	stopWatch := make(chan struct{})
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			slog.Info("SIGHUP received, reloading configuration")
+			reloadConfig(app, configPath)
+		}
+	}()
+
+	if reload := app.Config().Reload; reload.Watch {
+		go config.WatchConfig(configPath, reload.Interval, stopWatch, func() {
+			slog.Info("config file changed, reloading configuration", "path", configPath)
+			reloadConfig(app, configPath)
+		})
+	}
+
+	return func() {
+		signal.Stop(hup)
+		close(hup)
+		close(stopWatch)
+	}
+}
+
+// reloadConfig applies the config file and logs what changed. An invalid file
+// is reported and the running configuration kept.
+func reloadConfig(app *handlers.App, configPath string) {
+	changes, err := app.Reload(configPath)
+	if err != nil {
+		slog.Error("failed to reload configuration, keeping the current one", "error", err)
+		return
+	}
+	if len(changes) == 0 {
+		slog.Info("configuration unchanged")
+		return
+	}
+	for _, change := range changes {
+		slog.Info("configuration changed", "change", change)
+	}
+
+	if err := logging.SetLevel(app.Config().Log.Level); err != nil {
+		slog.Error("failed to change log level", "error", err)
+	}
+}
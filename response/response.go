@@ -0,0 +1,107 @@
+// Package response writes every JSON answer of the API in one envelope, so
+// clients handle success and errors the same way on every route:
+//
+//	{"status": true, "message": "User created", "data": {...}, "request_id": "..."}
+//	{"status": false, "code": "not_found", "message": "User not found", "request_id": "..."}
+//
+// request_id matches the X-Request-ID header and the request log line.
+package response
+
+import (
+	"encoding/json"
+	"net/http"
+	"watcher/logging"
+)
+
+// Code identifies the kind of error independently of the message text, which
+// is meant for people and may change.
+type Code string
+
+const (
+	CodeInvalidRequest     Code = "invalid_request"     // malformed body, parameter or value
+	CodeUnauthorized       Code = "unauthorized"        // no, expired or revoked session or API token
+	CodeInvalidCredentials Code = "invalid_credentials" // wrong NIP or password
+	CodeInvalidCode        Code = "invalid_code"        // wrong TOTP or recovery code
+	CodeForbidden          Code = "forbidden"           // authenticated but not allowed
+	CodeCSRF               Code = "csrf_invalid"        // missing or wrong X-CSRF-Token
+	CodeTwoFactorRequired  Code = "two_factor_required" // the role requires 2FA enrollment first
+	CodeNotFound           Code = "not_found"           // route or resource does not exist
+	CodeMethodNotAllowed   Code = "method_not_allowed"  // route exists for other methods
+	CodeConflict           Code = "conflict"            // e.g. duplicate NIP, 2FA already enabled
+	CodeTooManyRequests    Code = "too_many_requests"   // login throttling, see Retry-After
+	CodeInternal           Code = "internal_error"      // details are in the log under request_id
+	CodeUnavailable        Code = "service_unavailable" // a dependency is down, see Retry-After
+)
+
+var codeStatus = map[Code]int{
+	CodeInvalidRequest:     http.StatusBadRequest,
+	CodeUnauthorized:       http.StatusUnauthorized,
+	CodeInvalidCredentials: http.StatusUnauthorized,
+	CodeInvalidCode:        http.StatusUnauthorized,
+	CodeForbidden:          http.StatusForbidden,
+	CodeCSRF:               http.StatusForbidden,
+	CodeTwoFactorRequired:  http.StatusForbidden,
+	CodeNotFound:           http.StatusNotFound,
+	CodeMethodNotAllowed:   http.StatusMethodNotAllowed,
+	CodeConflict:           http.StatusConflict,
+	CodeTooManyRequests:    http.StatusTooManyRequests,
+	CodeInternal:           http.StatusInternalServerError,
+	CodeUnavailable:        http.StatusServiceUnavailable,
+}
+
+// HTTPStatus returns the status code sent with c.
+func (c Code) HTTPStatus() int {
+	if status, ok := codeStatus[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Envelope is the body of every JSON response. Code is set on errors only.
+type Envelope struct {
+	Status    bool   `json:"status"`
+	Code      Code   `json:"code,omitempty"`
+	Message   string `json:"message,omitempty"`
+	Data      any    `json:"data,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func write(w http.ResponseWriter, r *http.Request, status int, env Envelope) {
+	env.RequestID = logging.RequestID(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(env)
+}
+
+// JSON answers a successful request with status and data, which may be nil.
+func JSON(w http.ResponseWriter, r *http.Request, status int, message string, data any) {
+	write(w, r, status, Envelope{Status: true, Message: message, Data: data})
+}
+
+// OK answers 200 with data, which may be nil.
+func OK(w http.ResponseWriter, r *http.Request, message string, data any) {
+	JSON(w, r, http.StatusOK, message, data)
+}
+
+// Created answers 201 with the new resource.
+func Created(w http.ResponseWriter, r *http.Request, message string, data any) {
+	JSON(w, r, http.StatusCreated, message, data)
+}
+
+// Error answers with the status of code.
+func Error(w http.ResponseWriter, r *http.Request, code Code, message string) {
+	write(w, r, code.HTTPStatus(), Envelope{Code: code, Message: message})
+}
+
+// ErrorData answers with the status of code and data that helps the client
+// recover, e.g. the accepted values of a field.
+func ErrorData(w http.ResponseWriter, r *http.Request, code Code, message string, data any) {
+	write(w, r, code.HTTPStatus(), Envelope{Code: code, Message: message, Data: data})
+}
+
+// Internal logs err with the request ID and answers 500 with message only,
+// so driver and file system errors do not reach the client.
+func Internal(w http.ResponseWriter, r *http.Request, message string, err error) {
+	logging.From(r.Context()).Error(message, "error", err)
+	Error(w, r, CodeInternal, message)
+}
@@ -1,93 +1,171 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 	"watcher/config"
 	"watcher/handlers"
+	"watcher/logging"
+	"watcher/metrics"
 
-	"github.com/gorilla/mux" // Import Gorilla Mux
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/robfig/cron/v3"
 )
 
-func skip(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		next.ServeHTTP(w, r)
-	})
-}
-
 func main() {
-	// Load configuration
-	if err := config.LoadConfig(); err != nil {
-		fmt.Printf("Error loading configuration: %s\n", err)
-		return
+	// Load configuration: --config flag, then GOFS_CONFIG, then the default path
+	configPath := flag.String("config", "", "path to config.yaml (default $GOFS_CONFIG or "+config.DefaultConfigPath+")")
+	flag.Parse()
+	if *configPath == "" {
+		*configPath = os.Getenv("GOFS_CONFIG")
+	}
+	if *configPath == "" {
+		*configPath = config.DefaultConfigPath
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading configuration: %s\n", err)
+		os.Exit(1)
+	}
+	if err := logging.Setup(os.Stderr, cfg.Log.Format, cfg.Log.Level); err != nil {
+		fmt.Fprintf(os.Stderr, "Error setting up logging: %s\n", err)
+		os.Exit(1)
+	}
+	services := config.NewServices(cfg)
+
+	// a failed start exits 1 so supervisors (Restart=on-failure) see it
+	startupFailed := func(msg string, err error) {
+		slog.Error(msg, "error", err)
+		services.Close()
+		os.Exit(1)
+	}
+
+	// gofs migrate up|down|status applies schema migrations and exits
+	if flag.Arg(0) == "migrate" {
+		code := runMigrate(services, flag.Args()[1:])
+		services.Close()
+		os.Exit(code)
+	}
+
+	// Initialize the session store (Redis, or in-memory for development)
+	if err := services.InitSessionStore(); err != nil {
+		startupFailed("failed to initialize session store", err)
+	}
+
+	// Initialize MySQL client, applying pending schema migrations
+	if err := services.InitMySQL(); err != nil {
+		startupFailed("failed to initialize MySQL", err)
 	}
 
-	// Initialize Redis client
-	if err := config.InitRedis(); err != nil {
-		fmt.Printf("Error initializing Redis: %s\n", err)
-		return
+	// Select the credential backend (MySQL users table or LDAP)
+	app, err := handlers.NewApp(services)
+	if err != nil {
+		startupFailed("failed to initialize authenticator", err)
 	}
 
-	// Initialize MySQL client
-	if err := config.InitMySQL(); err != nil {
-		fmt.Printf("Error initializing MySQL: %s\n", err)
-		return
+	// Reload config.yaml on SIGHUP (and on file changes with reload.watch)
+	stopReloads := handleReloads(app, *configPath)
+
+	// Create the scratch directories the daily cleanup empties, /readyz checks them
+	paths := app.Config().Paths
+	for _, dir := range []string{paths.PDFCompressionInput(), paths.PDFCompressionOutput()} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			slog.Error("failed to create directory", "dir", dir, "error", err)
+		}
 	}
 
+	// Expose MySQL and Redis pool statistics on /metrics
+	prometheus.MustRegister(metrics.NewPoolCollector(services))
+
 	c := cron.New()
-	c.AddFunc("@daily", func() {
-		fmt.Println("Running daily cleanup...")
-		cleanupDirs("tmp/pdfcompression/input", "tmp/pdfcompression/output")
-	})
+	c.AddFunc("@daily", metrics.CronJob("cleanup", func() error {
+		slog.Info("running daily cleanup")
+		paths := app.Config().Paths
+		return cleanupDirs(paths.PDFCompressionInput(), paths.PDFCompressionOutput())
+	}))
 	c.Start()
 
-	router := mux.NewRouter() // Create a new Gorilla Mux router
+	serverCfg := app.Config().Server
+	server := &http.Server{
+		Addr:              serverCfg.Addr,
+		Handler:           app.Handler(), // Gorilla Mux router behind request logging
+		ReadHeaderTimeout: serverCfg.ReadHeaderTimeout,
+		ReadTimeout:       serverCfg.ReadTimeout,
+		WriteTimeout:      serverCfg.WriteTimeout,
+		IdleTimeout:       serverCfg.IdleTimeout,
+	}
 
-	// Public routes (no authentication required)
-	router.HandleFunc("/auth/login", handlers.LoginHandler).Methods("POST")
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("server starting", "url", "http://"+serverCfg.Addr+"/")
+		serverErr <- server.ListenAndServe()
+	}()
 
-	// ------------ Auth Middleware ---------------------
-	authenticatedRouter := router.PathPrefix("/").Subrouter()
-	// uncomment line below
-	// authenticatedRouter.Use(handlers.AuthMiddleware)
+	// Run until SIGINT/SIGTERM, or until the listener fails
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	exitCode := 0
+	select {
+	case err := <-serverErr:
+		slog.Error("failed to start server", "error", err)
+		exitCode = 1
+	case sig := <-quit:
+		slog.Info("shutting down", "signal", sig.String())
+	}
+	signal.Stop(quit)
+	stopReloads()
 
-	//! ---------- no auth --- dev only --
-	//! to activate auth on route,comment line below and uncomment out the auth middleware
-	authenticatedRouter.Use(skip)
+	shutdown(server, c, services, app.Config().Server.ShutdownTimeout)
+	os.Exit(exitCode)
+}
 
-	// ---------- route requiring authentication
-	authenticatedRouter.HandleFunc("/", handlers.HomeHandler).Methods("GET")
+// shutdown stops accepting requests and waits for running handlers and cron
+// jobs until timeout, then closes the session store and the MySQL pools.
+func shutdown(server *http.Server, c *cron.Cron, services *config.Services, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	authenticatedRouter.HandleFunc("/outbox/update", handlers.UpdateOutboxHandler).Methods("GET")
-	authenticatedRouter.HandleFunc("/outbox/get", handlers.GetOutboxData).Methods("GET")
-	authenticatedRouter.HandleFunc("/docvault/update", handlers.UpdateDocVaultHandler).Methods("GET")
-	authenticatedRouter.HandleFunc("/docvault/get", handlers.GetDocVaultHandler).Methods("GET")
-	authenticatedRouter.HandleFunc("/auth/session", handlers.GetSessionHandler).Methods("GET")
-	authenticatedRouter.HandleFunc("/mfwp/get/{npwp:[0-9]{15}}", handlers.GetMfwpData).Methods("GET")
-	authenticatedRouter.HandleFunc("/utils/pdfcompression", handlers.PDFCompressionHandler).Methods("POST")
-	authenticatedRouter.HandleFunc("/docs/generate", handlers.DocsGenerateHandler).Methods("GET") // generate markdown from based on /raw/*
-	authenticatedRouter.HandleFunc("/docs/create", handlers.CreateDocHandler).Methods("POST")     // init new documentation
+	cronDone := c.Stop() // no new jobs; running ones finish
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("requests still running at shutdown deadline", "error", err)
+	}
+	select {
+	case <-cronDone.Done():
+	case <-ctx.Done():
+		slog.Error("cron jobs still running at shutdown deadline")
+	}
 
-	fmt.Println("Server starting on port http://localhost:3000/ ")
-	// Use the Gorilla Mux router
-	if err := http.ListenAndServe("localhost:3000", router); err != nil {
-		fmt.Printf("Error starting server: %s\n", err)
+	if err := services.Close(); err != nil {
+		slog.Error("failed to close connections", "error", err)
 	}
+	slog.Info("server stopped")
 }
 
-func cleanupDirs(dirs ...string) {
+// cleanupDirs empties the directories and returns the errors of all of them.
+func cleanupDirs(dirs ...string) error {
+	var errs []error
 	for _, dir := range dirs {
 		err := os.RemoveAll(dir)
 		if err != nil {
-			fmt.Printf("Error cleaning up directory %s: %v\n", dir, err)
+			slog.Error("failed to clean up directory", "dir", dir, "error", err)
+			errs = append(errs, err)
 		} else {
-			fmt.Printf("Cleaned up directory: %s\n", dir)
+			slog.Info("cleaned up directory", "dir", dir)
 		}
 		err = os.MkdirAll(dir, 0755)
 		if err != nil {
-			fmt.Printf("Error recreating directory %s: %v\n", dir, err)
+			slog.Error("failed to recreate directory", "dir", dir, "error", err)
+			errs = append(errs, err)
 		}
 	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,384 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process SessionStore. Data is lost on restart and not
+// shared between processes, so it is meant for development and tests.
+type MemoryStore struct {
+	mu   sync.Mutex
+	data map[string]*memoryEntry
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type memoryEntry struct {
+	str     *string
+	hash    map[string]string
+	set     map[string]struct{}
+	expires time.Time // zero means no expiry
+}
+
+// NewMemoryStore returns an empty MemoryStore that drops expired keys every
+// sweepInterval.
+func NewMemoryStore(sweepInterval time.Duration) *MemoryStore {
+	s := &MemoryStore{
+		data: make(map[string]*memoryEntry),
+		stop: make(chan struct{}),
+	}
+	go s.sweep(sweepInterval)
+	return s
+}
+
+func (s *MemoryStore) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for key, entry := range s.data {
+				if entry.expired(now) {
+					delete(s.data, key)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// lookup returns a live entry; the caller holds s.mu.
+func (s *MemoryStore) lookup(key string) *memoryEntry {
+	entry, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+	if entry.expired(time.Now()) {
+		delete(s.data, key)
+		return nil
+	}
+	return entry
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.lookup(key)
+	if entry == nil || entry.str == nil {
+		return "", ErrNotFound
+	}
+	return *entry.str, nil
+}
+
+func (s *MemoryStore) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lookup(key) != nil {
+		return false, nil
+	}
+	memoryWriter{s}.Set(ctx, key, value, ttl)
+	return true, nil
+}
+
+func (s *MemoryStore) Exists(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lookup(key) != nil, nil
+}
+
+func (s *MemoryStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.lookup(key)
+	if entry == nil || entry.expires.IsZero() {
+		return 0, nil
+	}
+	return time.Until(entry.expires), nil
+}
+
+func (s *MemoryStore) Incr(ctx context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	entry := s.lookup(key)
+	if entry != nil {
+		if entry.str == nil {
+			return 0, fmt.Errorf("key %s does not hold a string", key)
+		}
+		parsed, err := strconv.ParseInt(*entry.str, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("key %s does not hold an integer", key)
+		}
+		n = parsed
+	}
+
+	n++
+	memoryWriter{s}.Set(ctx, key, strconv.FormatInt(n, 10), KeepTTL)
+	return n, nil
+}
+
+func (s *MemoryStore) HGet(ctx context.Context, key, field string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.lookup(key)
+	if entry == nil {
+		return "", ErrNotFound
+	}
+	val, ok := entry.hash[field]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return val, nil
+}
+
+func (s *MemoryStore) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make(map[string]string)
+	if entry := s.lookup(key); entry != nil {
+		for field, val := range entry.hash {
+			result[field] = val
+		}
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) SMembers(ctx context.Context, key string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	members := make([]string, 0)
+	if entry := s.lookup(key); entry != nil {
+		for member := range entry.set {
+			members = append(members, member)
+		}
+	}
+	return members, nil
+}
+
+// Atomic queues the writes of fn and applies them together only if fn
+// succeeds, as a Redis MULTI does.
+func (s *MemoryStore) Atomic(ctx context.Context, fn func(tx Writer) error) error {
+	var tx memoryTx
+	if err := fn(&tx); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := memoryWriter{s}
+	for _, op := range tx.ops {
+		// like EXEC, a failing command does not stop the others
+		op(w)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	return nil
+}
+
+// Writer methods lock the store and delegate to memoryWriter.
+
+func (s *MemoryStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return memoryWriter{s}.Set(ctx, key, value, ttl)
+}
+
+func (s *MemoryStore) Del(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return memoryWriter{s}.Del(ctx, keys...)
+}
+
+func (s *MemoryStore) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return memoryWriter{s}.Expire(ctx, key, ttl)
+}
+
+func (s *MemoryStore) ExpireAt(ctx context.Context, key string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return memoryWriter{s}.ExpireAt(ctx, key, at)
+}
+
+func (s *MemoryStore) HSet(ctx context.Context, key string, values map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return memoryWriter{s}.HSet(ctx, key, values)
+}
+
+func (s *MemoryStore) HDel(ctx context.Context, key string, fields ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return memoryWriter{s}.HDel(ctx, key, fields...)
+}
+
+func (s *MemoryStore) SAdd(ctx context.Context, key string, members ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return memoryWriter{s}.SAdd(ctx, key, members...)
+}
+
+func (s *MemoryStore) SRem(ctx context.Context, key string, members ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return memoryWriter{s}.SRem(ctx, key, members...)
+}
+
+// memoryWriter implements Writer for a MemoryStore whose lock is already held.
+type memoryWriter struct {
+	s *MemoryStore
+}
+
+func (w memoryWriter) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	var expires time.Time
+	if ttl == KeepTTL {
+		if entry := w.s.lookup(key); entry != nil {
+			expires = entry.expires
+		}
+	} else if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	w.s.data[key] = &memoryEntry{str: &value, expires: expires}
+	return nil
+}
+
+func (w memoryWriter) Del(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		delete(w.s.data, key)
+	}
+	return nil
+}
+
+func (w memoryWriter) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return w.ExpireAt(ctx, key, time.Now().Add(ttl))
+}
+
+func (w memoryWriter) ExpireAt(ctx context.Context, key string, at time.Time) error {
+	if entry := w.s.lookup(key); entry != nil {
+		entry.expires = at
+	}
+	return nil
+}
+
+func (w memoryWriter) HSet(ctx context.Context, key string, values map[string]string) error {
+	entry := w.s.lookup(key)
+	if entry == nil {
+		entry = &memoryEntry{hash: make(map[string]string)}
+		w.s.data[key] = entry
+	}
+	if entry.hash == nil {
+		return fmt.Errorf("key %s does not hold a hash", key)
+	}
+	for field, val := range values {
+		entry.hash[field] = val
+	}
+	return nil
+}
+
+func (w memoryWriter) HDel(ctx context.Context, key string, fields ...string) error {
+	if entry := w.s.lookup(key); entry != nil {
+		for _, field := range fields {
+			delete(entry.hash, field)
+		}
+		if len(entry.hash) == 0 {
+			delete(w.s.data, key)
+		}
+	}
+	return nil
+}
+
+func (w memoryWriter) SAdd(ctx context.Context, key string, members ...string) error {
+	entry := w.s.lookup(key)
+	if entry == nil {
+		entry = &memoryEntry{set: make(map[string]struct{})}
+		w.s.data[key] = entry
+	}
+	if entry.set == nil {
+		return fmt.Errorf("key %s does not hold a set", key)
+	}
+	for _, member := range members {
+		entry.set[member] = struct{}{}
+	}
+	return nil
+}
+
+func (w memoryWriter) SRem(ctx context.Context, key string, members ...string) error {
+	if entry := w.s.lookup(key); entry != nil {
+		for _, member := range members {
+			delete(entry.set, member)
+		}
+		if len(entry.set) == 0 {
+			delete(w.s.data, key)
+		}
+	}
+	return nil
+}
+
+// memoryTx implements Writer by queueing the writes of an Atomic call.
+type memoryTx struct {
+	ops []func(w memoryWriter) error
+}
+
+func (tx *memoryTx) queue(op func(w memoryWriter) error) error {
+	tx.ops = append(tx.ops, op)
+	return nil
+}
+
+func (tx *memoryTx) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return tx.queue(func(w memoryWriter) error { return w.Set(ctx, key, value, ttl) })
+}
+
+func (tx *memoryTx) Del(ctx context.Context, keys ...string) error {
+	return tx.queue(func(w memoryWriter) error { return w.Del(ctx, keys...) })
+}
+
+func (tx *memoryTx) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return tx.queue(func(w memoryWriter) error { return w.Expire(ctx, key, ttl) })
+}
+
+func (tx *memoryTx) ExpireAt(ctx context.Context, key string, at time.Time) error {
+	return tx.queue(func(w memoryWriter) error { return w.ExpireAt(ctx, key, at) })
+}
+
+func (tx *memoryTx) HSet(ctx context.Context, key string, values map[string]string) error {
+	return tx.queue(func(w memoryWriter) error { return w.HSet(ctx, key, values) })
+}
+
+func (tx *memoryTx) HDel(ctx context.Context, key string, fields ...string) error {
+	return tx.queue(func(w memoryWriter) error { return w.HDel(ctx, key, fields...) })
+}
+
+func (tx *memoryTx) SAdd(ctx context.Context, key string, members ...string) error {
+	return tx.queue(func(w memoryWriter) error { return w.SAdd(ctx, key, members...) })
+}
+
+func (tx *memoryTx) SRem(ctx context.Context, key string, members ...string) error {
+	return tx.queue(func(w memoryWriter) error { return w.SRem(ctx, key, members...) })
+}
@@ -0,0 +1,200 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestMemoryStore(t *testing.T, sweepInterval time.Duration) *MemoryStore {
+	t.Helper()
+	s := NewMemoryStore(sweepInterval)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	s := newTestMemoryStore(t, time.Hour)
+
+	s.Set(ctx, "short", "v", 50*time.Millisecond)
+	s.Set(ctx, "forever", "v", 0)
+	if ttl, _ := s.TTL(ctx, "short"); ttl <= 0 || ttl > 50*time.Millisecond {
+		t.Errorf("TTL of short = %s, want (0, 50ms]", ttl)
+	}
+	if ttl, _ := s.TTL(ctx, "forever"); ttl != 0 {
+		t.Errorf("TTL without expiry = %s, want 0", ttl)
+	}
+
+	// KeepTTL and Expire change the value and the deadline independently
+	s.Set(ctx, "kept", "v", time.Hour)
+	s.Set(ctx, "kept", "w", KeepTTL)
+	if ttl, _ := s.TTL(ctx, "kept"); ttl < 59*time.Minute {
+		t.Errorf("TTL after Set with KeepTTL = %s, want about 1h", ttl)
+	}
+	s.Expire(ctx, "forever", 50*time.Millisecond)
+
+	time.Sleep(60 * time.Millisecond)
+	for _, key := range []string{"short", "forever"} {
+		if _, err := s.Get(ctx, key); err != ErrNotFound {
+			t.Errorf("Get(%s) after expiry: err = %v, want ErrNotFound", key, err)
+		}
+		if ok, _ := s.Exists(ctx, key); ok {
+			t.Errorf("Exists(%s) after expiry = true", key)
+		}
+	}
+	if v, err := s.Get(ctx, "kept"); v != "w" || err != nil {
+		t.Errorf("Get(kept) = %q, %v; want w", v, err)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	ctx := context.Background()
+	s := newTestMemoryStore(t, 10*time.Millisecond)
+	s.Set(ctx, "a", "v", 20*time.Millisecond)
+	s.HSet(ctx, "h", map[string]string{"f": "v"})
+	s.Expire(ctx, "h", 20*time.Millisecond)
+
+	time.Sleep(60 * time.Millisecond)
+	s.mu.Lock()
+	left := len(s.data)
+	s.mu.Unlock()
+	if left != 0 {
+		t.Errorf("%d expired keys left after sweeping, want 0", left)
+	}
+}
+
+func TestMemoryStoreSetNX(t *testing.T) {
+	ctx := context.Background()
+	s := newTestMemoryStore(t, time.Hour)
+
+	var won atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, err := s.SetNX(ctx, "lock", "v", 50*time.Millisecond); ok && err == nil {
+				won.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := won.Load(); n != 1 {
+		t.Errorf("%d of 50 parallel SetNX succeeded, want 1", n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if ok, _ := s.SetNX(ctx, "lock", "v", time.Minute); !ok {
+		t.Error("SetNX after the key expired = false, want true")
+	}
+}
+
+func TestMemoryStoreIncr(t *testing.T) {
+	ctx := context.Background()
+	s := newTestMemoryStore(t, time.Hour)
+
+	for want := int64(1); want <= 3; want++ {
+		if n, err := s.Incr(ctx, "missing"); n != want || err != nil {
+			t.Fatalf("Incr = %d, %v; want %d", n, err, want)
+		}
+	}
+	if ttl, _ := s.TTL(ctx, "missing"); ttl != 0 {
+		t.Errorf("TTL of a counter created by Incr = %s, want none", ttl)
+	}
+
+	s.Expire(ctx, "missing", time.Hour)
+	s.Incr(ctx, "missing")
+	if ttl, _ := s.TTL(ctx, "missing"); ttl < 59*time.Minute {
+		t.Errorf("TTL after Incr = %s, want the expiry kept", ttl)
+	}
+
+	s.Set(ctx, "text", "abc", 0)
+	if _, err := s.Incr(ctx, "text"); err == nil {
+		t.Error("Incr of a non-integer succeeded")
+	}
+	s.HSet(ctx, "hash", map[string]string{"f": "1"})
+	if _, err := s.Incr(ctx, "hash"); err == nil {
+		t.Error("Incr of a hash succeeded")
+	}
+}
+
+func TestMemoryStoreHashesAndSets(t *testing.T) {
+	ctx := context.Background()
+	s := newTestMemoryStore(t, time.Hour)
+
+	s.HSet(ctx, "h", map[string]string{"a": "1", "b": "2"})
+	s.HSet(ctx, "h", map[string]string{"b": "3"})
+	if v, err := s.HGet(ctx, "h", "b"); v != "3" || err != nil {
+		t.Errorf("HGet = %q, %v; want 3", v, err)
+	}
+	if _, err := s.HGet(ctx, "h", "c"); err != ErrNotFound {
+		t.Errorf("HGet of a missing field: err = %v, want ErrNotFound", err)
+	}
+	s.HDel(ctx, "h", "a", "b")
+	if ok, _ := s.Exists(ctx, "h"); ok {
+		t.Error("hash still exists after deleting its last field")
+	}
+
+	s.SAdd(ctx, "set", "x", "y", "x")
+	s.SRem(ctx, "set", "y")
+	members, _ := s.SMembers(ctx, "set")
+	sort.Strings(members)
+	if len(members) != 1 || members[0] != "x" {
+		t.Errorf("SMembers = %v, want [x]", members)
+	}
+
+	s.Set(ctx, "text", "v", 0)
+	if err := s.HSet(ctx, "text", map[string]string{"f": "v"}); err == nil {
+		t.Error("HSet on a string succeeded")
+	}
+	if err := s.SAdd(ctx, "h2", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.HSet(ctx, "h2", map[string]string{"f": "v"}); err == nil {
+		t.Error("HSet on a set succeeded")
+	}
+}
+
+func TestMemoryStoreAtomic(t *testing.T) {
+	ctx := context.Background()
+	s := newTestMemoryStore(t, time.Hour)
+	s.Set(ctx, "a", "1", 0)
+
+	failed := errors.New("failed")
+	err := s.Atomic(ctx, func(tx Writer) error {
+		tx.Set(ctx, "a", "2", 0)
+		tx.SAdd(ctx, "set", "x")
+		tx.Del(ctx, "a")
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("Atomic = %v, want the error of fn", err)
+	}
+	if v, _ := s.Get(ctx, "a"); v != "1" {
+		t.Errorf("a = %q after a failed Atomic, want 1", v)
+	}
+	if ok, _ := s.Exists(ctx, "set"); ok {
+		t.Error("set written by a failed Atomic")
+	}
+
+	err = s.Atomic(ctx, func(tx Writer) error {
+		tx.Set(ctx, "a", "2", 0)
+		tx.SAdd(ctx, "set", "x")
+		tx.Expire(ctx, "set", time.Hour)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.Get(ctx, "a"); v != "2" {
+		t.Errorf("a = %q after Atomic, want 2", v)
+	}
+	if ttl, _ := s.TTL(ctx, "set"); ttl < 59*time.Minute {
+		t.Errorf("TTL of set = %s, want the Expire queued after SAdd applied", ttl)
+	}
+}
@@ -0,0 +1,176 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisStore is a SessionStore backed by Redis. The go-redis client reconnects
+// on its own; RedisStore only watches the connection and logs outages.
+type RedisStore struct {
+	redisWriter
+	client *redis.Client
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewRedisStore wraps a Redis client and starts watching its connection every
+// checkInterval.
+func NewRedisStore(client *redis.Client, checkInterval time.Duration) *RedisStore {
+	s := &RedisStore{
+		redisWriter: redisWriter{cmd: client},
+		client:      client,
+		stop:        make(chan struct{}),
+	}
+	go s.watch(checkInterval)
+	return s
+}
+
+// watch pings Redis periodically and logs when it becomes unreachable or recovers.
+func (s *RedisStore) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	healthy := true
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			err := s.Ping(context.Background())
+			if err != nil && healthy {
+				slog.Error("Redis connection lost, retrying", "error", err)
+			}
+			if err == nil && !healthy {
+				slog.Info("Redis connection restored")
+			}
+			healthy = err == nil
+		}
+	}
+}
+
+// Client returns the underlying Redis client.
+func (s *RedisStore) Client() *redis.Client {
+	return s.client
+}
+
+func notFound(err error) error {
+	if errors.Is(err, redis.Nil) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) (string, error) {
+	val, err := s.client.Get(ctx, key).Result()
+	return val, notFound(err)
+}
+
+func (s *RedisStore) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, key, value, ttl).Result()
+}
+
+func (s *RedisStore) Exists(ctx context.Context, key string) (bool, error) {
+	n, err := s.client.Exists(ctx, key).Result()
+	return n > 0, err
+}
+
+func (s *RedisStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(ctx, key).Result()
+	if err != nil || ttl < 0 {
+		// -1 no expiry, -2 missing key
+		return 0, err
+	}
+	return ttl, nil
+}
+
+func (s *RedisStore) Incr(ctx context.Context, key string) (int64, error) {
+	return s.client.Incr(ctx, key).Result()
+}
+
+func (s *RedisStore) HGet(ctx context.Context, key, field string) (string, error) {
+	val, err := s.client.HGet(ctx, key, field).Result()
+	return val, notFound(err)
+}
+
+func (s *RedisStore) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return s.client.HGetAll(ctx, key).Result()
+}
+
+func (s *RedisStore) SMembers(ctx context.Context, key string) ([]string, error) {
+	return s.client.SMembers(ctx, key).Result()
+}
+
+func (s *RedisStore) Atomic(ctx context.Context, fn func(tx Writer) error) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		return fn(redisWriter{cmd: pipe})
+	})
+	return err
+}
+
+func (s *RedisStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+func (s *RedisStore) Close() error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	return s.client.Close()
+}
+
+// redisWriter implements Writer on either the client or a transaction pipeline.
+type redisWriter struct {
+	cmd redis.Cmdable
+}
+
+func (w redisWriter) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	if ttl == KeepTTL {
+		ttl = redis.KeepTTL
+	}
+	return w.cmd.Set(ctx, key, value, ttl).Err()
+}
+
+func (w redisWriter) Del(ctx context.Context, keys ...string) error {
+	return w.cmd.Del(ctx, keys...).Err()
+}
+
+func (w redisWriter) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return w.cmd.Expire(ctx, key, ttl).Err()
+}
+
+func (w redisWriter) ExpireAt(ctx context.Context, key string, at time.Time) error {
+	return w.cmd.ExpireAt(ctx, key, at).Err()
+}
+
+func (w redisWriter) HSet(ctx context.Context, key string, values map[string]string) error {
+	args := make([]any, 0, len(values)*2)
+	for field, value := range values {
+		args = append(args, field, value)
+	}
+	return w.cmd.HSet(ctx, key, args...).Err()
+}
+
+func (w redisWriter) HDel(ctx context.Context, key string, fields ...string) error {
+	return w.cmd.HDel(ctx, key, fields...).Err()
+}
+
+func (w redisWriter) SAdd(ctx context.Context, key string, members ...string) error {
+	args := make([]any, len(members))
+	for i, member := range members {
+		args[i] = member
+	}
+	return w.cmd.SAdd(ctx, key, args...).Err()
+}
+
+func (w redisWriter) SRem(ctx context.Context, key string, members ...string) error {
+	args := make([]any, len(members))
+	for i, member := range members {
+		args[i] = member
+	}
+	return w.cmd.SRem(ctx, key, args...).Err()
+}
@@ -0,0 +1,52 @@
+// Package store holds the key-value backends behind sessions and the other
+// short-lived auth state (API tokens, login throttling, 2FA challenges).
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when a key, hash field or value does not exist.
+var ErrNotFound = errors.New("key not found")
+
+// KeepTTL passed as the ttl of Set keeps the key's current expiry.
+const KeepTTL time.Duration = -1
+
+// Writer holds the write operations that can be grouped with Atomic.
+type Writer interface {
+	// Set stores a value. A ttl of 0 means no expiry.
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	Del(ctx context.Context, keys ...string) error
+	Expire(ctx context.Context, key string, ttl time.Duration) error
+	ExpireAt(ctx context.Context, key string, at time.Time) error
+	HSet(ctx context.Context, key string, values map[string]string) error
+	HDel(ctx context.Context, key string, fields ...string) error
+	SAdd(ctx context.Context, key string, members ...string) error
+	SRem(ctx context.Context, key string, members ...string) error
+}
+
+// SessionStore is a small subset of Redis semantics: strings, hashes and sets
+// with per-key expiry. RedisStore is used in production and MemoryStore on
+// developer machines and in tests.
+type SessionStore interface {
+	Writer
+
+	Get(ctx context.Context, key string) (string, error)
+	// SetNX stores a value only if the key does not exist and reports whether it did.
+	SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	// TTL returns the remaining lifetime of a key, or 0 if it is missing or has none.
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	Incr(ctx context.Context, key string) (int64, error)
+	HGet(ctx context.Context, key, field string) (string, error)
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	SMembers(ctx context.Context, key string) ([]string, error)
+
+	// Atomic applies the writes made by fn as a single transaction.
+	Atomic(ctx context.Context, fn func(tx Writer) error) error
+
+	Ping(ctx context.Context) error
+	Close() error
+}
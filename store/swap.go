@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// SwapStore forwards every call to a SessionStore that can be replaced while
+// requests are using it, e.g. when a config reload points sessions at
+// another Redis. Calls already running finish on the old store.
+type SwapStore struct {
+	current atomic.Pointer[storeRef]
+}
+
+type storeRef struct {
+	SessionStore
+}
+
+// NewSwapStore returns a SwapStore forwarding to s.
+func NewSwapStore(s SessionStore) *SwapStore {
+	w := &SwapStore{}
+	w.current.Store(&storeRef{s})
+	return w
+}
+
+// Swap makes new requests use s and returns the store used until now, which
+// the caller closes once in-flight requests had time to finish.
+func (w *SwapStore) Swap(s SessionStore) SessionStore {
+	return w.current.Swap(&storeRef{s}).SessionStore
+}
+
+// Current returns the store calls are forwarded to.
+func (w *SwapStore) Current() SessionStore {
+	return w.current.Load().SessionStore
+}
+
+func (w *SwapStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return w.Current().Set(ctx, key, value, ttl)
+}
+
+func (w *SwapStore) Del(ctx context.Context, keys ...string) error {
+	return w.Current().Del(ctx, keys...)
+}
+
+func (w *SwapStore) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return w.Current().Expire(ctx, key, ttl)
+}
+
+func (w *SwapStore) ExpireAt(ctx context.Context, key string, at time.Time) error {
+	return w.Current().ExpireAt(ctx, key, at)
+}
+
+func (w *SwapStore) HSet(ctx context.Context, key string, values map[string]string) error {
+	return w.Current().HSet(ctx, key, values)
+}
+
+func (w *SwapStore) HDel(ctx context.Context, key string, fields ...string) error {
+	return w.Current().HDel(ctx, key, fields...)
+}
+
+func (w *SwapStore) SAdd(ctx context.Context, key string, members ...string) error {
+	return w.Current().SAdd(ctx, key, members...)
+}
+
+func (w *SwapStore) SRem(ctx context.Context, key string, members ...string) error {
+	return w.Current().SRem(ctx, key, members...)
+}
+
+func (w *SwapStore) Get(ctx context.Context, key string) (string, error) {
+	return w.Current().Get(ctx, key)
+}
+
+func (w *SwapStore) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return w.Current().SetNX(ctx, key, value, ttl)
+}
+
+func (w *SwapStore) Exists(ctx context.Context, key string) (bool, error) {
+	return w.Current().Exists(ctx, key)
+}
+
+func (w *SwapStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return w.Current().TTL(ctx, key)
+}
+
+func (w *SwapStore) Incr(ctx context.Context, key string) (int64, error) {
+	return w.Current().Incr(ctx, key)
+}
+
+func (w *SwapStore) HGet(ctx context.Context, key, field string) (string, error) {
+	return w.Current().HGet(ctx, key, field)
+}
+
+func (w *SwapStore) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return w.Current().HGetAll(ctx, key)
+}
+
+func (w *SwapStore) SMembers(ctx context.Context, key string) ([]string, error) {
+	return w.Current().SMembers(ctx, key)
+}
+
+func (w *SwapStore) Atomic(ctx context.Context, fn func(tx Writer) error) error {
+	return w.Current().Atomic(ctx, fn)
+}
+
+func (w *SwapStore) Ping(ctx context.Context) error {
+	return w.Current().Ping(ctx)
+}
+
+// Close closes the current store.
+func (w *SwapStore) Close() error {
+	return w.Current().Close()
+}